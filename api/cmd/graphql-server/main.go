@@ -16,6 +16,7 @@ import (
 	"eventify/api/internal/transport/graphql/generated"
 	gqlmiddleware "eventify/api/internal/transport/graphql/middleware"
 	"eventify/api/internal/transport/graphql/resolvers"
+	"eventify/api/internal/transport/probes"
 	"eventify/platform/logger"
 	"eventify/platform/postgres"
 	"eventify/platform/telemetry"
@@ -67,6 +68,9 @@ func main() {
 	// Auth attaches claims when a valid bearer token is present; mutations
 	// require them, queries do not.
 	router.Handle("/query", gqlmiddleware.Auth(jwtProvider)(srv))
+	for path, h := range probes.Routes(probes.New(pool), pool) {
+		router.Handle(path, h).Methods(http.MethodGet)
+	}
 
 	// The old server listened on :3001 while the ReadMe documented :8080.
 	httpServer := &http.Server{
@@ -14,11 +14,13 @@ import (
 	"eventify/api/internal/transport/grpc/handlers"
 	"eventify/api/internal/transport/grpc/interceptors"
 	"eventify/api/internal/transport/grpc/proto"
+	"eventify/api/internal/transport/probes"
 	"eventify/platform/logger"
 	"eventify/platform/postgres"
 	"eventify/platform/telemetry"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -60,6 +62,10 @@ func main() {
 		List:   events.NewGetEventsHandler(pool).Handle,
 		Delete: events.NewDeleteEventHandler(pool).Handle,
 	}))
+	// grpc.health.v1, for grpc-health-probe and Kubernetes' grpc probes. The
+	// auth interceptor lets Check through without a token.
+	healthpb.RegisterHealthServer(server,
+		probes.NewGRPCServer(probes.New(pool), proto.EventService_ServiceDesc.ServiceName))
 	reflection.Register(server)
 
 	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
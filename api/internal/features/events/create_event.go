@@ -97,7 +97,10 @@ func (h CreateEventHandler) Handle(ctx context.Context, cmd CreateEventCommand)
 		DoneBy:     cmd.CreatedBy.String(),
 		OccurredAt: res.CreatedAt.UTC(),
 	}
-	if err := outbox.Enqueue(ctx, tx, contracts.EventCreatedName, messageID, evt); err != nil {
+	// Keyed on the event, so that whatever is later published about it is
+	// delivered after its creation.
+	if err := outbox.Enqueue(ctx, tx, contracts.EventCreatedName, messageID, evt,
+		outbox.WithPartitionKey(res.EventID.String())); err != nil {
 		return res, apperrors.Wrap(apperrors.Internal, "enqueue EventCreated", err)
 	}
 
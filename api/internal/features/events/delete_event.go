@@ -2,38 +2,74 @@ package events
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	contracts "eventify/events"
+	"eventify/outbox"
 	"eventify/platform/apperrors"
-	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // DeleteEventCommand removes an event.
 type DeleteEventCommand struct {
 	EventID uuid.UUID
+	// DeletedBy is the caller deleting it, taken from their token.
+	DeletedBy uuid.UUID
 }
 
-// DeleteEventHandler removes an event.
+// DeleteEventHandler removes an event and emits EventDeleted, in its own
+// transaction.
 type DeleteEventHandler struct {
-	db postgres.Querier
+	pool *pgxpool.Pool
 }
 
-func NewDeleteEventHandler(db postgres.Querier) DeleteEventHandler {
-	return DeleteEventHandler{db: db}
+func NewDeleteEventHandler(pool *pgxpool.Pool) DeleteEventHandler {
+	return DeleteEventHandler{pool: pool}
 }
 
-// Handle deletes the event, reporting NotFound when nothing matched.
+// Handle deletes the event and enqueues EventDeleted in one transaction,
+// reporting NotFound when nothing matched.
 //
 // The old DeleteEvent returned nil whether or not a row was removed, so a
 // caller deleting a nonexistent id received 200 OK.
 func (h DeleteEventHandler) Handle(ctx context.Context, cmd DeleteEventCommand) error {
-	tag, err := h.db.Exec(ctx, `DELETE FROM events WHERE id = $1`, cmd.EventID)
+	tx, err := h.pool.Begin(ctx)
 	if err != nil {
-		return apperrors.Wrap(apperrors.Internal, "delete event", err)
+		return apperrors.Wrap(apperrors.Internal, "begin transaction", err)
 	}
-	if tag.RowsAffected() == 0 {
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var deletedAt time.Time
+	err = tx.QueryRow(ctx,
+		`DELETE FROM events WHERE id = $1 RETURNING clock_timestamp()`, cmd.EventID,
+	).Scan(&deletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return apperrors.New(apperrors.NotFound, "event not found")
 	}
+	if err != nil {
+		return apperrors.Wrap(apperrors.Internal, "delete event", err)
+	}
+
+	messageID := uuid.New()
+	evt := contracts.EventDeleted{
+		MessageID:  messageID,
+		ID:         cmd.EventID,
+		DoneBy:     cmd.DeletedBy.String(),
+		OccurredAt: deletedAt.UTC(),
+	}
+	// Keyed on the event, so the deletion is delivered after everything
+	// published about it before.
+	if err := outbox.Enqueue(ctx, tx, contracts.EventDeletedName, messageID, evt,
+		outbox.WithPartitionKey(cmd.EventID.String())); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "enqueue EventDeleted", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "commit transaction", err)
+	}
 	return nil
 }
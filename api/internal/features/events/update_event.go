@@ -3,13 +3,17 @@ package events
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
+	"eventify/api/internal/domain"
+	contracts "eventify/events"
+	"eventify/outbox"
 	"eventify/platform/apperrors"
-	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // UpdateEventCommand updates every mutable field of an event.
@@ -22,7 +26,9 @@ type UpdateEventCommand struct {
 	Category    string
 	Tags        []string
 	EventID     uuid.UUID
-	Capacity    int
+	// UpdatedBy is the caller making the update, taken from their token.
+	UpdatedBy uuid.UUID
+	Capacity  int
 }
 
 // UpdateEventResult reports what was written.
@@ -31,16 +37,30 @@ type UpdateEventResult struct {
 	EventID   uuid.UUID
 }
 
-// UpdateEventHandler is shared by HTTP v1, HTTP v2, gRPC and GraphQL.
+// UpdateEventHandler is shared by HTTP v1, HTTP v2, gRPC and GraphQL. It emits
+// EventUpdated, so like CreateEventHandler it holds the pool and opens its own
+// transaction.
 type UpdateEventHandler struct {
-	db postgres.Querier
+	pool *pgxpool.Pool
 }
 
-func NewUpdateEventHandler(db postgres.Querier) UpdateEventHandler {
-	return UpdateEventHandler{db: db}
+func NewUpdateEventHandler(pool *pgxpool.Pool) UpdateEventHandler {
+	return UpdateEventHandler{pool: pool}
 }
 
-// Handle updates the event and returns its new state.
+// Handle updates the event, and enqueues EventUpdated naming the fields that
+// changed, in one transaction.
+//
+// The current row is read FOR UPDATE first, so two concurrent updates cannot
+// both compare against the same old row and each report the other's change.
+//
+// updated_at, which EventUpdated carries as OccurredAt, is stamped once that
+// lock is held, with clock_timestamp() rather than now(). now() is when the
+// transaction began, and an update that began first can take the lock last:
+// it would commit the newer row under the older time, and the subscriber,
+// which keeps the update with the latest OccurredAt, would drop it as stale.
+// The stamp is never earlier than the one it replaces, even if the clock is
+// stepped back.
 //
 // Two bugs the old code had, worth not reintroducing:
 //
@@ -64,22 +84,77 @@ func (h UpdateEventHandler) Handle(ctx context.Context, cmd UpdateEventCommand)
 		return res, apperrors.Wrap(apperrors.Invalid, "encode tags", err)
 	}
 
-	err = h.db.QueryRow(ctx,
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	current, err := scanEvent(tx.QueryRow(ctx,
+		`SELECT `+columns+` FROM events WHERE id = $1 FOR UPDATE`, cmd.EventID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, apperrors.New(apperrors.NotFound, "event not found")
+	}
+	if err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "read event", err)
+	}
+
+	err = tx.QueryRow(ctx,
 		`UPDATE events
 		    SET name = $2, description = $3, location = $4, date = $5,
 		        organizer = $6, category = $7, tags = $8, capacity = $9,
-		        updated_at = now()
+		        updated_at = GREATEST(clock_timestamp()::timestamp, updated_at + interval '1 microsecond')
 		  WHERE id = $1
 		  RETURNING id, updated_at`,
 		cmd.EventID, cmd.Name, cmd.Description, cmd.Location, cmd.Date,
 		cmd.Organizer, cmd.Category, tags, cmd.Capacity,
 	).Scan(&res.EventID, &res.UpdatedAt)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return res, apperrors.New(apperrors.NotFound, "event not found")
-	}
 	if err != nil {
 		return res, apperrors.Wrap(apperrors.Internal, "update event", err)
 	}
+
+	// An update that changes nothing still bumps updated_at, but tells a
+	// consumer nothing, and publishes nothing.
+	if changed := changedFields(current, cmd); len(changed) > 0 {
+		messageID := uuid.New()
+		evt := contracts.EventUpdated{
+			MessageID:     messageID,
+			ID:            res.EventID,
+			Name:          cmd.Name,
+			Type:          cmd.Category,
+			ChangedFields: changed,
+			DoneBy:        cmd.UpdatedBy.String(),
+			OccurredAt:    res.UpdatedAt.UTC(),
+		}
+		// Keyed on the event, as its EventCreated was, so the two are
+		// delivered in order.
+		if err := outbox.Enqueue(ctx, tx, contracts.EventUpdatedName, messageID, evt,
+			outbox.WithPartitionKey(res.EventID.String())); err != nil {
+			return res, apperrors.Wrap(apperrors.Internal, "enqueue EventUpdated", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "commit transaction", err)
+	}
 	return res, nil
 }
+
+// changedFields names the columns cmd changes on current, in column order.
+func changedFields(current domain.Event, cmd UpdateEventCommand) []string {
+	var changed []string
+	add := func(column string, differs bool) {
+		if differs {
+			changed = append(changed, column)
+		}
+	}
+	add("name", current.Name != cmd.Name)
+	add("description", current.Description != cmd.Description)
+	add("location", current.Location != cmd.Location)
+	add("date", !current.Date.Equal(cmd.Date))
+	add("organizer", current.Organizer != cmd.Organizer)
+	add("category", current.Category != cmd.Category)
+	add("tags", !slices.Equal(current.Tags, cmd.Tags))
+	add("capacity", current.Capacity != cmd.Capacity)
+	return changed
+}
@@ -3,12 +3,16 @@ package roles
 import (
 	"context"
 	"errors"
+	"time"
 
+	"eventify/events"
+	"eventify/outbox"
 	"eventify/platform/apperrors"
 	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const foreignKeyViolation = "23503"
@@ -17,12 +21,17 @@ const foreignKeyViolation = "23503"
 type AssignRoleCommand struct {
 	UserID uuid.UUID
 	RoleID uuid.UUID
+	// AssignedBy is the administrator granting it, taken from their token.
+	AssignedBy uuid.UUID
 }
 
-// AssignRoleHandler grants a role.
-type AssignRoleHandler struct{ db postgres.Querier }
+// AssignRoleHandler grants a role and emits RoleAssigned, in its own
+// transaction.
+type AssignRoleHandler struct{ pool *pgxpool.Pool }
 
-func NewAssignRoleHandler(db postgres.Querier) AssignRoleHandler { return AssignRoleHandler{db: db} }
+func NewAssignRoleHandler(pool *pgxpool.Pool) AssignRoleHandler {
+	return AssignRoleHandler{pool: pool}
+}
 
 // Handle grants the role, tolerating a repeat grant.
 //
@@ -30,8 +39,17 @@ func NewAssignRoleHandler(db postgres.Querier) AssignRoleHandler { return Assign
 // bare INSERT, so granting the same role twice surfaced a driver error as a
 // 500. A missing user or role is a Postgres foreign-key violation, which maps
 // to Invalid rather than a 500.
+//
+// RoleAssigned is enqueued in the same transaction, and only by the grant that
+// inserted the row: a repeat changes nothing, so it announces nothing.
 func (h AssignRoleHandler) Handle(ctx context.Context, cmd AssignRoleCommand) error {
-	_, err := h.db.Exec(ctx,
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return apperrors.Wrap(apperrors.Internal, "begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx,
 		`INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)
 		 ON CONFLICT DO NOTHING`,
 		cmd.UserID, cmd.RoleID)
@@ -43,6 +61,38 @@ func (h AssignRoleHandler) Handle(ctx context.Context, cmd AssignRoleCommand) er
 	if err != nil {
 		return apperrors.Wrap(apperrors.Internal, "assign role", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	var (
+		roleName   string
+		assignedAt time.Time
+	)
+	if err := tx.QueryRow(ctx, `SELECT name, now() FROM roles WHERE id = $1`, cmd.RoleID).
+		Scan(&roleName, &assignedAt); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "load role", err)
+	}
+
+	messageID := uuid.New()
+	evt := events.RoleAssigned{
+		MessageID:  messageID,
+		UserID:     cmd.UserID,
+		RoleID:     cmd.RoleID,
+		RoleName:   roleName,
+		DoneBy:     cmd.AssignedBy.String(),
+		OccurredAt: assignedAt.UTC(),
+	}
+	// Keyed on the user, like UserSignedUp, so a grant is never delivered
+	// before the signup of the account it was made to.
+	if err := outbox.Enqueue(ctx, tx, events.RoleAssignedName, messageID, evt,
+		outbox.WithPartitionKey(cmd.UserID.String())); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "enqueue RoleAssigned", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "commit transaction", err)
+	}
 	return nil
 }
 
@@ -3,12 +3,16 @@ package users
 import (
 	"context"
 	"errors"
+	"time"
 
+	"eventify/events"
+	"eventify/outbox"
 	"eventify/platform/apperrors"
 	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,27 +23,34 @@ type ChangePasswordCommand struct {
 	UserID          uuid.UUID
 }
 
-// ChangePasswordHandler verifies then rotates.
+// ChangePasswordHandler verifies then rotates, emitting PasswordChanged.
 type ChangePasswordHandler struct {
-	db postgres.Querier
+	pool *pgxpool.Pool
 }
 
-func NewChangePasswordHandler(db postgres.Querier) ChangePasswordHandler {
-	return ChangePasswordHandler{db: db}
+func NewChangePasswordHandler(pool *pgxpool.Pool) ChangePasswordHandler {
+	return ChangePasswordHandler{pool: pool}
 }
 
 // Handle checks the current password, then writes the new hash.
 //
 // Two round trips (read the hash, write the new one) so the read lives in an
-// unexported helper. It is not wrapped in a transaction: the read is only a
-// guard, and a concurrent rotation that wins the race simply means one of the
-// two new passwords survives, which is the same outcome as serialising them.
+// unexported helper. They share a transaction only so the write commits with
+// its PasswordChanged: the read takes no lock, because it is only a guard, and
+// a concurrent rotation that wins the race simply means one of the two new
+// passwords survives, which is the same outcome as serialising them.
 func (h ChangePasswordHandler) Handle(ctx context.Context, cmd ChangePasswordCommand) error {
 	if len(cmd.NewPassword) < 8 {
 		return apperrors.New(apperrors.Invalid, "password must be at least 8 characters")
 	}
 
-	current, err := h.passwordHash(ctx, cmd.UserID)
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return apperrors.Wrap(apperrors.Internal, "begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	current, err := passwordHash(ctx, tx, cmd.UserID)
 	if err != nil {
 		return err
 	}
@@ -47,12 +58,18 @@ func (h ChangePasswordHandler) Handle(ctx context.Context, cmd ChangePasswordCom
 		return apperrors.New(apperrors.Unauthorized, "current password is incorrect")
 	}
 
-	return SetPassword(ctx, h.db, cmd.UserID, cmd.NewPassword)
+	if err := SetPassword(ctx, tx, cmd.UserID, cmd.NewPassword, cmd.UserID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "commit transaction", err)
+	}
+	return nil
 }
 
-func (h ChangePasswordHandler) passwordHash(ctx context.Context, id uuid.UUID) (string, error) {
+func passwordHash(ctx context.Context, db postgres.Querier, id uuid.UUID) (string, error) {
 	var hash string
-	err := h.db.QueryRow(ctx, `SELECT password FROM users WHERE id = $1`, id).Scan(&hash)
+	err := db.QueryRow(ctx, `SELECT password FROM users WHERE id = $1`, id).Scan(&hash)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return "", apperrors.New(apperrors.NotFound, "user not found")
 	}
@@ -62,10 +79,15 @@ func (h ChangePasswordHandler) passwordHash(ctx context.Context, id uuid.UUID) (
 	return hash, nil
 }
 
-// SetPassword hashes and stores a new password. Exported because the password
-// reset flow, which authenticates by token rather than by old password, needs
-// exactly this and nothing else.
-func SetPassword(ctx context.Context, db postgres.Querier, id uuid.UUID, plaintext string) error {
+// SetPassword hashes and stores a new password, and enqueues PasswordChanged
+// naming doneBy as who changed it. Exported because the password reset flow,
+// which authenticates by token rather than by old password, needs exactly this
+// and nothing else.
+//
+// The notice is enqueued here rather than by each caller, so that no way of
+// replacing a password can forget to tell its owner. db must therefore be the
+// transaction the caller commits; see outbox.Enqueue.
+func SetPassword(ctx context.Context, db postgres.Querier, id uuid.UUID, plaintext string, doneBy uuid.UUID) error {
 	if len(plaintext) < 8 {
 		return apperrors.New(apperrors.Invalid, "password must be at least 8 characters")
 	}
@@ -75,13 +97,27 @@ func SetPassword(ctx context.Context, db postgres.Querier, id uuid.UUID, plainte
 		return apperrors.Wrap(apperrors.Internal, "hash password", err)
 	}
 
-	tag, err := db.Exec(ctx,
-		`UPDATE users SET password = $2, updated_at = now() WHERE id = $1`, id, string(hashed))
+	var changedAt time.Time
+	err = db.QueryRow(ctx,
+		`UPDATE users SET password = $2, updated_at = now() WHERE id = $1 RETURNING updated_at`,
+		id, string(hashed)).Scan(&changedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperrors.New(apperrors.NotFound, "user not found")
+	}
 	if err != nil {
 		return apperrors.Wrap(apperrors.Internal, "update password", err)
 	}
-	if tag.RowsAffected() == 0 {
-		return apperrors.New(apperrors.NotFound, "user not found")
+
+	messageID := uuid.New()
+	evt := events.PasswordChanged{
+		MessageID:  messageID,
+		UserID:     id,
+		DoneBy:     doneBy.String(),
+		OccurredAt: changedAt.UTC(),
+	}
+	if err := outbox.Enqueue(ctx, db, events.PasswordChangedName, messageID, evt,
+		outbox.WithPartitionKey(id.String())); err != nil {
+		return apperrors.Wrap(apperrors.Internal, "enqueue PasswordChanged", err)
 	}
 	return nil
 }
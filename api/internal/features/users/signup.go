@@ -4,10 +4,12 @@ import (
 	"context"
 	"time"
 
+	"eventify/events"
+	"eventify/outbox"
 	"eventify/platform/apperrors"
-	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,16 +27,17 @@ type SignupResult struct {
 	UserID    uuid.UUID
 }
 
-// SignupHandler creates a user.
+// SignupHandler creates a user and emits UserSignedUp, in its own transaction.
 type SignupHandler struct {
-	db postgres.Querier
+	pool *pgxpool.Pool
 }
 
-func NewSignupHandler(db postgres.Querier) SignupHandler {
-	return SignupHandler{db: db}
+func NewSignupHandler(pool *pgxpool.Pool) SignupHandler {
+	return SignupHandler{pool: pool}
 }
 
-// Handle hashes the password and inserts the user.
+// Handle hashes the password, inserts the user and enqueues UserSignedUp in one
+// transaction.
 //
 // A duplicate email is detected by the UNIQUE constraint, not by a preceding
 // SELECT. The old AuthController.Signup called GetByEmail first and returned
@@ -52,7 +55,13 @@ func (h SignupHandler) Handle(ctx context.Context, cmd SignupCommand) (SignupRes
 		return res, apperrors.Wrap(apperrors.Internal, "hash password", err)
 	}
 
-	err = h.db.QueryRow(ctx,
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = tx.QueryRow(ctx,
 		`INSERT INTO users (id, email, password, first_name, last_name, created_at)
 		 VALUES ($1, $2, $3, $4, $5, now())
 		 RETURNING id, created_at`,
@@ -65,5 +74,25 @@ func (h SignupHandler) Handle(ctx context.Context, cmd SignupCommand) (SignupRes
 	if err != nil {
 		return res, apperrors.Wrap(apperrors.Internal, "insert user", err)
 	}
+
+	messageID := uuid.New()
+	evt := events.UserSignedUp{
+		MessageID:  messageID,
+		UserID:     res.UserID,
+		Email:      cmd.Email,
+		FirstName:  cmd.FirstName,
+		LastName:   cmd.LastName,
+		OccurredAt: res.CreatedAt.UTC(),
+	}
+	// Keyed on the user, so everything published about one account is
+	// delivered in the order it happened.
+	if err := outbox.Enqueue(ctx, tx, events.UserSignedUpName, messageID, evt,
+		outbox.WithPartitionKey(res.UserID.String())); err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "enqueue UserSignedUp", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return res, apperrors.Wrap(apperrors.Internal, "commit transaction", err)
+	}
 	return res, nil
 }
@@ -0,0 +1,88 @@
+// Package buildinfo reports what is running: the commit a binary was built
+// from, and the schema version of the database it is talking to.
+package buildinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"eventify/platform/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Commit is the commit the binary was built from. The build sets it with
+//
+//	-ldflags "-X eventify/api/internal/shared/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// and when it does not, Revision falls back to what the Go toolchain stamped.
+var Commit string
+
+// Revision returns Commit, or else the VCS revision the toolchain recorded,
+// suffixed "-dirty" if the tree had uncommitted changes, or else "unknown".
+func Revision() string {
+	if Commit != "" {
+		return Commit
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var rev, modified string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if rev == "" {
+		return "unknown"
+	}
+	if modified == "true" {
+		rev += "-dirty"
+	}
+	return rev
+}
+
+// MigrationsTable is the table golang-migrate records the api module's
+// migrations in. The outbox and subscribers modules migrate the same database
+// from their own directories, each into a table of its own, so their version
+// numbers never mix with this one; see MIGRATIONS in the Makefile.
+const MigrationsTable = "api_schema_migrations"
+
+// Info is what /version reports.
+type Info struct {
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+	// MigrationVersion is the last api migration golang-migrate recorded as
+	// applied in MigrationsTable, and MigrationDirty whether it failed
+	// halfway. A database never migrated has neither.
+	MigrationVersion *int64 `json:"migration_version"`
+	MigrationDirty   bool   `json:"migration_dirty"`
+}
+
+// Read returns the binary's Info, with the migration state read through q.
+func Read(ctx context.Context, q postgres.Querier) (Info, error) {
+	info := Info{Commit: Revision(), GoVersion: runtime.Version()}
+
+	var version int64
+	err := q.QueryRow(ctx, `SELECT version, dirty FROM `+pgx.Identifier{MigrationsTable}.Sanitize()+` LIMIT 1`).
+		Scan(&version, &info.MigrationDirty)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return info, nil
+	case errors.As(err, &pgErr) && pgErr.Code == "42P01": // undefined_table
+		return info, nil
+	case err != nil:
+		return info, fmt.Errorf("read migration version: %w", err)
+	}
+	info.MigrationVersion = &version
+	return info, nil
+}
@@ -102,7 +102,8 @@ func (r *mutationResolver) CreateEvent(ctx context.Context, input models.CreateE
 }
 
 func (r *mutationResolver) UpdateEvent(ctx context.Context, id string, input models.UpdateEventInput) (*models.UpdateEventResponse, error) {
-	if _, ok := gqlmiddleware.Claims(ctx); !ok {
+	claims, ok := gqlmiddleware.Claims(ctx)
+	if !ok {
 		return nil, gqlError(apperrors.New(apperrors.Unauthorized, "authentication required"))
 	}
 
@@ -130,6 +131,7 @@ func (r *mutationResolver) UpdateEvent(ctx context.Context, id string, input mod
 		Category:    current.Category,
 		Tags:        current.Tags,
 		Capacity:    current.Capacity,
+		UpdatedBy:   claims.UserID,
 	}
 	if input.Name != nil {
 		cmd.Name = *input.Name
@@ -172,7 +174,8 @@ func (r *mutationResolver) UpdateEvent(ctx context.Context, id string, input mod
 }
 
 func (r *mutationResolver) DeleteEvent(ctx context.Context, id string) (*models.DeleteEventResponse, error) {
-	if _, ok := gqlmiddleware.Claims(ctx); !ok {
+	claims, ok := gqlmiddleware.Claims(ctx)
+	if !ok {
 		return nil, gqlError(apperrors.New(apperrors.Unauthorized, "authentication required"))
 	}
 
@@ -181,7 +184,7 @@ func (r *mutationResolver) DeleteEvent(ctx context.Context, id string) (*models.
 		return nil, gqlError(apperrors.New(apperrors.Invalid, "invalid event id"))
 	}
 
-	if err := r.Delete(ctx, events.DeleteEventCommand{EventID: eventID}); err != nil {
+	if err := r.Delete(ctx, events.DeleteEventCommand{EventID: eventID, DeletedBy: claims.UserID}); err != nil {
 		return nil, gqlError(err)
 	}
 	return &models.DeleteEventResponse{Message: "event deleted"}, nil
@@ -129,10 +129,12 @@ func (h *EventHandler) UpdateEvent(ctx context.Context, req *proto.UpdateEventRe
 		return nil, status.Error(codes.InvalidArgument, "invalid event id")
 	}
 
+	claims, _ := interceptors.Claims(ctx)
+
 	if _, err := h.h.Update(ctx, events.UpdateEventCommand{
 		EventID: id, Name: req.Name, Description: req.Description, Date: req.Date.AsTime(),
 		Location: req.Location, Organizer: req.Organizer, Category: req.Category,
-		Tags: req.Tags, Capacity: int(req.Capacity),
+		Tags: req.Tags, Capacity: int(req.Capacity), UpdatedBy: claims.UserID,
 	}); err != nil {
 		return nil, grpcError(err)
 	}
@@ -155,7 +157,9 @@ func (h *EventHandler) DeleteEvent(ctx context.Context, req *proto.DeleteEventRe
 		return nil, status.Error(codes.InvalidArgument, "invalid event id")
 	}
 
-	if err := h.h.Delete(ctx, events.DeleteEventCommand{EventID: id}); err != nil {
+	claims, _ := interceptors.Claims(ctx)
+
+	if err := h.h.Delete(ctx, events.DeleteEventCommand{EventID: id, DeletedBy: claims.UserID}); err != nil {
 		return nil, grpcError(err)
 	}
 	return &proto.DeleteEventResponse{Message: "event deleted"}, nil
@@ -14,6 +14,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
@@ -28,8 +29,10 @@ func Claims(ctx context.Context) (*auth.CustomClaims, bool) {
 	return c, ok
 }
 
-// publicMethods may be called without a token.
-var publicMethods = map[string]bool{}
+// publicMethods may be called without a token. A health probe carries none.
+var publicMethods = map[string]bool{
+	healthpb.Health_Check_FullMethodName: true,
+}
 
 // Auth validates the bearer token in the `authorization` metadata header and
 // attaches the claims to the context.
@@ -14,9 +14,11 @@ import (
 	v1events "eventify/api/internal/transport/http/v1/events"
 	v1password "eventify/api/internal/transport/http/v1/password"
 	v2events "eventify/api/internal/transport/http/v2/events"
+	"eventify/api/internal/transport/probes"
 	"eventify/platform/telemetry"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -33,6 +35,11 @@ func NewApp(pool *pgxpool.Pool, jwtProvider auth.IJWTProvider, adapter telemetry
 	app.Use(cors.New())
 	app.Use(middleware.Telemetry(adapter))
 
+	// Probes go before every versioned group, and none of them needs a token.
+	for path, h := range probes.Routes(probes.New(pool), pool) {
+		app.Get(path, adaptor.HTTPHandler(h))
+	}
+
 	// CreateEventHandler takes the pool, not a Querier, because it opens its own
 	// transaction to write the event and its outbox row atomically.
 	create := events.NewCreateEventHandler(pool)
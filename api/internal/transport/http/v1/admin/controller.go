@@ -157,13 +157,18 @@ func (c *Controller) GetUserRoles(ctx *fiber.Ctx) error {
 }
 
 func (c *Controller) AssignRole(ctx *fiber.Ctx) error {
+	claims, ok := middleware.Claims(ctx)
+	if !ok {
+		return httperr.Write(ctx, apperrors.New(apperrors.Unauthorized, "authentication required"))
+	}
+
 	var req assignRoleRequest
 	if err := ctx.BodyParser(&req); err != nil {
 		return httperr.Write(ctx, apperrors.New(apperrors.Invalid, "invalid request body"))
 	}
 
 	if err := c.h.AssignRole(ctx.UserContext(), roles.AssignRoleCommand{
-		UserID: req.UserID, RoleID: req.RoleID,
+		UserID: req.UserID, RoleID: req.RoleID, AssignedBy: claims.UserID,
 	}); err != nil {
 		return httperr.Write(ctx, err)
 	}
@@ -172,10 +172,15 @@ func (c *Controller) Update(ctx *fiber.Ctx) error {
 		return httperr.Write(ctx, apperrors.Wrap(apperrors.Invalid, "invalid request body", err))
 	}
 
+	claims, ok := middleware.Claims(ctx)
+	if !ok {
+		return httperr.Write(ctx, apperrors.New(apperrors.Unauthorized, "authentication required"))
+	}
+
 	res, err := c.h.Update(ctx.UserContext(), events.UpdateEventCommand{
 		EventID: id, Name: req.Name, Description: req.Description, Location: req.Location,
 		Date: req.Date, Organizer: req.Organizer, Category: req.Category,
-		Tags: req.Tags, Capacity: req.Capacity,
+		Tags: req.Tags, Capacity: req.Capacity, UpdatedBy: claims.UserID,
 	})
 	if err != nil {
 		return httperr.Write(ctx, err)
@@ -198,7 +203,12 @@ func (c *Controller) Delete(ctx *fiber.Ctx) error {
 		return httperr.Write(ctx, apperrors.New(apperrors.Invalid, "invalid event id"))
 	}
 
-	if err := c.h.Delete(ctx.UserContext(), events.DeleteEventCommand{EventID: id}); err != nil {
+	claims, ok := middleware.Claims(ctx)
+	if !ok {
+		return httperr.Write(ctx, apperrors.New(apperrors.Unauthorized, "authentication required"))
+	}
+
+	if err := c.h.Delete(ctx.UserContext(), events.DeleteEventCommand{EventID: id, DeletedBy: claims.UserID}); err != nil {
 		return httperr.Write(ctx, err)
 	}
 	return ctx.SendStatus(fiber.StatusNoContent)
@@ -6,6 +6,7 @@ import (
 	"eventify/api/internal/domain"
 	"eventify/api/internal/features/events"
 	"eventify/api/internal/transport/http/httperr"
+	"eventify/api/internal/transport/http/middleware"
 	"eventify/platform/apperrors"
 
 	"github.com/gofiber/fiber/v2"
@@ -102,11 +103,16 @@ func (c *Controller) Update(ctx *fiber.Ctx) error {
 		return httperr.Write(ctx, apperrors.Wrap(apperrors.Invalid, "invalid request body", err))
 	}
 
+	claims, ok := middleware.Claims(ctx)
+	if !ok {
+		return httperr.Write(ctx, apperrors.New(apperrors.Unauthorized, "authentication required"))
+	}
+
 	// The v2 DTO maps onto the v1 command. No new SQL.
 	if _, err := c.h.Update(ctx.UserContext(), events.UpdateEventCommand{
 		EventID: id, Name: req.Name, Description: req.Description, Location: req.Location,
 		Date: req.Date, Organizer: req.Organiser, Category: req.Category,
-		Tags: req.Tags, Capacity: req.Capacity,
+		Tags: req.Tags, Capacity: req.Capacity, UpdatedBy: claims.UserID,
 	}); err != nil {
 		return httperr.Write(ctx, err)
 	}
@@ -0,0 +1,100 @@
+// Package probes gives the three API servers the same health, readiness and
+// version endpoints, whatever transport each speaks: /healthz, /readyz and
+// /version over HTTP for the REST and GraphQL servers, and the standard
+// grpc.health.v1 service for the gRPC one.
+//
+// An API server's only dependency is its pgx pool. It is checked for
+// readiness, not liveness: a database outage is not fixed by restarting every
+// replica of the API at once.
+package probes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"eventify/api/internal/shared/buildinfo"
+	"eventify/platform/health"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// New returns the checks every API server runs.
+func New(pool *pgxpool.Pool) *health.Health {
+	h := health.New()
+	h.Ready("postgres", health.Ping(pool))
+	return h
+}
+
+// VersionHandler serves /version: the build commit and the api module's
+// migration version, as buildinfo.Info.
+func VersionHandler(pool *pgxpool.Pool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		info, err := buildinfo.Read(r.Context(), pool)
+		if err != nil {
+			// The commit is still worth knowing when the database is down.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(struct {
+				buildinfo.Info
+				Error string `json:"error"`
+			}{info, err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(info)
+	})
+}
+
+// Routes returns /healthz, /readyz and /version by path, for a server to
+// mount on whatever router it uses.
+func Routes(h *health.Health, pool *pgxpool.Pool) map[string]http.Handler {
+	return map[string]http.Handler{
+		"/healthz": h.LiveHandler(),
+		"/readyz":  h.ReadyHandler(),
+		"/version": VersionHandler(pool),
+	}
+}
+
+// LivenessService is the grpc.health.v1 service name that asks for liveness
+// alone. The empty name, and any service this server registers, ask for
+// readiness.
+const LivenessService = "liveness"
+
+// GRPCServer implements grpc.health.v1 over h, running its checks on every
+// Check. Watch is not implemented: probes poll.
+type GRPCServer struct {
+	healthpb.UnimplementedHealthServer
+	h        *health.Health
+	services map[string]bool
+}
+
+// NewGRPCServer serves h's checks, answering for the empty service name,
+// LivenessService, and each of services.
+func NewGRPCServer(h *health.Health, services ...string) *GRPCServer {
+	known := map[string]bool{"": true}
+	for _, s := range services {
+		known[s] = true
+	}
+	return &GRPCServer{h: h, services: known}
+}
+
+// Check reports SERVING if the checks the service name asks for pass, and
+// NOT_SERVING otherwise.
+func (s *GRPCServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	var err error
+	switch {
+	case req.GetService() == LivenessService:
+		err = s.h.CheckLive(ctx)
+	case s.services[req.GetService()]:
+		err = s.h.CheckReady(ctx)
+	default:
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+	if err != nil {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
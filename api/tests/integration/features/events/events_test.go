@@ -2,6 +2,7 @@ package events_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"eventify/platform/apperrors"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 )
@@ -65,12 +67,13 @@ func TestIntegrationCreateEvent(t *testing.T) {
 			status           int16
 			rowMessageID     uuid.UUID
 			payloadMessageID string
+			partitionKey     string
 		)
 		require.NoError(t, pool.QueryRow(ctx,
-			`SELECT payload_type, status, message_id, payload->>'message_id'
+			`SELECT payload_type, status, message_id, payload->>'message_id', partition_key
 			   FROM outbox_messages
 			  WHERE payload->>'id' = $1`, res.EventID.String()).
-			Scan(&payloadType, &status, &rowMessageID, &payloadMessageID))
+			Scan(&payloadType, &status, &rowMessageID, &payloadMessageID, &partitionKey))
 
 		require.Equal(t, contracts.EventCreatedName, payloadType)
 		require.Equal(t, int16(1), status, "relay has not run; the row must still be QUEUED")
@@ -79,6 +82,8 @@ func TestIntegrationCreateEvent(t *testing.T) {
 		// finds the row by the id on it. They must be the same value, or a
 		// duplicate delivery cannot be traced back to the row that caused it.
 		require.Equal(t, rowMessageID.String(), payloadMessageID)
+		require.Equal(t, res.EventID.String(), partitionKey,
+			"later messages about this event must be ordered after its creation")
 	})
 
 	t.Run("rejects capacity below one", func(t *testing.T) {
@@ -156,6 +161,32 @@ func TestIntegrationUpdateEvent(t *testing.T) {
 		require.Equal(t, 42, got.Capacity)
 	})
 
+	t.Run("enqueues EventUpdated naming only the fields that changed", func(t *testing.T) {
+		current, err := get.Handle(ctx, events.GetEventQuery{EventID: created.EventID})
+		require.NoError(t, err)
+
+		cmd := events.UpdateEventCommand{
+			EventID: created.EventID, Name: "Renamed again", Description: current.Description,
+			Location: current.Location, Date: current.Date, Organizer: current.Organizer,
+			Category: current.Category, Tags: current.Tags, Capacity: 50, UpdatedBy: userID,
+		}
+		_, err = update.Handle(ctx, cmd)
+		require.NoError(t, err)
+
+		evt, partitionKey := lastOutboxPayload[contracts.EventUpdated](t, pool, contracts.EventUpdatedName)
+		require.Equal(t, created.EventID, evt.ID)
+		require.Equal(t, []string{"name", "capacity"}, evt.ChangedFields)
+		require.Equal(t, "Renamed again", evt.Name, "the payload carries the new name")
+		require.Equal(t, userID.String(), evt.DoneBy)
+		require.Equal(t, created.EventID.String(), partitionKey)
+
+		// The same command again changes nothing, and publishes nothing.
+		before := countOutbox(t, pool)
+		_, err = update.Handle(ctx, cmd)
+		require.NoError(t, err)
+		require.Equal(t, before, countOutbox(t, pool))
+	})
+
 	t.Run("unknown id is NotFound, not a silent insert", func(t *testing.T) {
 		_, err := update.Handle(ctx, events.UpdateEventCommand{
 			EventID: uuid.New(), Name: "ghost", Capacity: 1,
@@ -164,6 +195,118 @@ func TestIntegrationUpdateEvent(t *testing.T) {
 	})
 }
 
+// holdKey marks a context whose update waits, its transaction already begun,
+// before it reads the event FOR UPDATE.
+type holdKey struct{}
+
+// hold is where an update marked with holdKey waits: it signals reached, and
+// goes on once release is closed.
+type hold struct {
+	reached chan struct{}
+	release chan struct{}
+}
+
+// holdAtLock is a pgx tracer that stops a marked update just short of the row
+// lock, which is how an update that began first comes to take the lock last.
+type holdAtLock struct{}
+
+func (holdAtLock) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if h, ok := ctx.Value(holdKey{}).(*hold); ok && strings.Contains(data.SQL, "FOR UPDATE") {
+		close(h.reached)
+		<-h.release
+	}
+	return ctx
+}
+
+func (holdAtLock) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// Two updates of one event overlap: the first begins, the second begins after
+// it but takes the row lock first and commits. The first commits last, so its
+// values are the event's — and its EventUpdated must carry the later
+// OccurredAt, or the subscriber, which keeps the update with the latest one,
+// drops it as stale and keeps the values it overwrote.
+func TestIntegrationUpdateEvent_TheLastCommitCarriesTheLatestTime(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	ctx := context.Background()
+
+	userID := seedUser(t, pool)
+	created, err := events.NewCreateEventHandler(pool).Handle(ctx, newEventCmd(userID))
+	require.NoError(t, err)
+
+	cfg := pool.Config()
+	cfg.ConnConfig.Tracer = holdAtLock{}
+	held, err := pgxpool.NewWithConfig(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(held.Close)
+
+	cmd := func(name string) events.UpdateEventCommand {
+		c := newEventCmd(userID)
+		return events.UpdateEventCommand{
+			EventID: created.EventID, Name: name, Description: c.Description, Location: c.Location,
+			Date: c.Date, Organizer: c.Organizer, Category: c.Category, Tags: c.Tags,
+			Capacity: c.Capacity, UpdatedBy: userID,
+		}
+	}
+
+	h := &hold{reached: make(chan struct{}), release: make(chan struct{})}
+	first := make(chan error, 1)
+	go func() {
+		_, err := events.NewUpdateEventHandler(held).Handle(context.WithValue(ctx, holdKey{}, h), cmd("began first"))
+		first <- err
+	}()
+	select {
+	case <-h.reached:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the first update never reached the row lock")
+	}
+
+	// Far enough apart that the two transactions' start times differ.
+	time.Sleep(50 * time.Millisecond)
+	_, err = events.NewUpdateEventHandler(pool).Handle(ctx, cmd("began second"))
+	require.NoError(t, err)
+	close(h.release)
+	require.NoError(t, <-first)
+
+	got, err := events.NewGetEventHandler(pool).Handle(ctx, events.GetEventQuery{EventID: created.EventID})
+	require.NoError(t, err)
+	require.Equal(t, "began first", got.Name, "the update that committed last holds the row")
+
+	rows, err := pool.Query(ctx,
+		`SELECT payload FROM outbox_messages
+		  WHERE payload_type = $1 AND partition_key = $2 ORDER BY seq`,
+		contracts.EventUpdatedName, created.EventID.String())
+	require.NoError(t, err)
+	updates, err := pgx.CollectRows(rows, pgx.RowTo[contracts.EventUpdated])
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	require.Equal(t, []string{"began second", "began first"}, []string{updates[0].Name, updates[1].Name})
+
+	// What the read model applies: the update with the latest OccurredAt.
+	latest := updates[0]
+	for _, u := range updates[1:] {
+		if u.OccurredAt.After(latest.OccurredAt) {
+			latest = u
+		}
+	}
+	require.Equal(t, got.Name, latest.Name, "the read model must end on the last commit")
+}
+
+// lastOutboxPayload decodes the payload of the newest outbox row of
+// payloadType, and returns it with the row's partition key.
+func lastOutboxPayload[T any](t *testing.T, pool *pgxpool.Pool, payloadType string) (T, string) {
+	t.Helper()
+	var (
+		evt          T
+		partitionKey string
+	)
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT payload, partition_key FROM outbox_messages
+		  WHERE payload_type = $1 ORDER BY seq DESC LIMIT 1`, payloadType).
+		Scan(&evt, &partitionKey))
+	return evt, partitionKey
+}
+
 func countEvents(t *testing.T, pool *pgxpool.Pool) int {
 	t.Helper()
 	var n int
@@ -224,11 +367,16 @@ func TestIntegrationGetAndDeleteEvent(t *testing.T) {
 		require.Equal(t, apperrors.NotFound, apperrors.KindOf(err))
 	})
 
-	t.Run("delete removes the row", func(t *testing.T) {
-		require.NoError(t, del.Handle(ctx, events.DeleteEventCommand{EventID: created.EventID}))
+	t.Run("delete removes the row and enqueues EventDeleted", func(t *testing.T) {
+		require.NoError(t, del.Handle(ctx, events.DeleteEventCommand{EventID: created.EventID, DeletedBy: userID}))
 
 		_, err := get.Handle(ctx, events.GetEventQuery{EventID: created.EventID})
 		require.Equal(t, apperrors.NotFound, apperrors.KindOf(err))
+
+		evt, partitionKey := lastOutboxPayload[contracts.EventDeleted](t, pool, contracts.EventDeletedName)
+		require.Equal(t, created.EventID, evt.ID)
+		require.Equal(t, userID.String(), evt.DoneBy)
+		require.Equal(t, created.EventID.String(), partitionKey)
 	})
 
 	t.Run("deleting a missing row is NotFound, not success", func(t *testing.T) {
@@ -0,0 +1,64 @@
+package roles_test
+
+import (
+	"context"
+	"testing"
+
+	"eventify/api/internal/features/roles"
+	"eventify/api/internal/features/users"
+	"eventify/api/tests/integration/testsupport"
+	"eventify/events"
+	"eventify/platform/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationAssignRole(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	ctx := context.Background()
+
+	user, err := users.NewSignupHandler(pool).Handle(ctx, users.SignupCommand{
+		Email: "grantee@example.com", Password: "correcthorse",
+	})
+	require.NoError(t, err)
+
+	var roleID uuid.UUID
+	require.NoError(t, pool.QueryRow(ctx, `SELECT id FROM roles WHERE name = 'event_manager'`).Scan(&roleID))
+
+	h := roles.NewAssignRoleHandler(pool)
+	admin := uuid.New()
+	countAssigned := func() int {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx,
+			`SELECT count(*) FROM outbox_messages WHERE payload_type = $1`, events.RoleAssignedName).Scan(&n))
+		return n
+	}
+
+	t.Run("enqueues RoleAssigned once, however often the role is granted", func(t *testing.T) {
+		cmd := roles.AssignRoleCommand{UserID: user.UserID, RoleID: roleID, AssignedBy: admin}
+		require.NoError(t, h.Handle(ctx, cmd))
+		require.NoError(t, h.Handle(ctx, cmd), "a repeat grant is not an error")
+		require.Equal(t, 1, countAssigned())
+
+		var (
+			evt          events.RoleAssigned
+			partitionKey string
+		)
+		require.NoError(t, pool.QueryRow(ctx,
+			`SELECT payload, partition_key FROM outbox_messages WHERE payload_type = $1`,
+			events.RoleAssignedName).Scan(&evt, &partitionKey))
+		require.Equal(t, user.UserID, evt.UserID)
+		require.Equal(t, roleID, evt.RoleID)
+		require.Equal(t, "event_manager", evt.RoleName)
+		require.Equal(t, admin.String(), evt.DoneBy)
+		require.Equal(t, user.UserID.String(), partitionKey)
+	})
+
+	t.Run("a missing role is Invalid and announces nothing", func(t *testing.T) {
+		err := h.Handle(ctx, roles.AssignRoleCommand{UserID: user.UserID, RoleID: uuid.New(), AssignedBy: admin})
+		require.Equal(t, apperrors.Invalid, apperrors.KindOf(err))
+		require.Equal(t, 1, countAssigned())
+	})
+}
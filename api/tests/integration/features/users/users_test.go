@@ -8,9 +8,11 @@ import (
 	"eventify/api/internal/features/users"
 	"eventify/api/internal/shared/auth"
 	"eventify/api/tests/integration/testsupport"
+	"eventify/events"
 	"eventify/platform/apperrors"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,6 +25,29 @@ func newJWT(t *testing.T) *auth.JWTProvider {
 	return p
 }
 
+// lastOutboxPayload decodes the payload of the newest outbox row of
+// payloadType, and returns it with the row's partition key.
+func lastOutboxPayload[T any](t *testing.T, pool *pgxpool.Pool, payloadType string) (T, string) {
+	t.Helper()
+	var (
+		evt          T
+		partitionKey string
+	)
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT payload, partition_key FROM outbox_messages
+		  WHERE payload_type = $1 ORDER BY seq DESC LIMIT 1`, payloadType).
+		Scan(&evt, &partitionKey))
+	return evt, partitionKey
+}
+
+func countOutbox(t *testing.T, pool *pgxpool.Pool, payloadType string) int {
+	t.Helper()
+	var n int
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT count(*) FROM outbox_messages WHERE payload_type = $1`, payloadType).Scan(&n))
+	return n
+}
+
 func TestIntegrationSignup(t *testing.T) {
 	testsupport.SkipUnlessDocker(t)
 	pool := testsupport.Pool(t)
@@ -43,6 +68,25 @@ func TestIntegrationSignup(t *testing.T) {
 		require.Contains(t, stored, "$2a$", "must be a bcrypt hash")
 	})
 
+	t.Run("enqueues UserSignedUp with the account, never the password", func(t *testing.T) {
+		res, err := h.Handle(ctx, users.SignupCommand{
+			Email: "welcome@example.com", Password: "correcthorse", FirstName: "W", LastName: "E",
+		})
+		require.NoError(t, err)
+
+		evt, partitionKey := lastOutboxPayload[events.UserSignedUp](t, pool, events.UserSignedUpName)
+		require.Equal(t, res.UserID, evt.UserID)
+		require.Equal(t, "welcome@example.com", evt.Email)
+		require.Equal(t, "W", evt.FirstName)
+		require.Equal(t, res.UserID.String(), partitionKey)
+
+		var raw string
+		require.NoError(t, pool.QueryRow(ctx,
+			`SELECT payload::text FROM outbox_messages WHERE message_id = $1`, evt.MessageID).Scan(&raw))
+		require.NotContains(t, raw, "correcthorse")
+		require.NotContains(t, raw, "password")
+	})
+
 	t.Run("duplicate email is Conflict, resolved by the unique constraint", func(t *testing.T) {
 		// The old Signup did SELECT-then-INSERT, which races: two concurrent
 		// requests both see no row, both insert, one gets a raw driver error
@@ -50,8 +94,11 @@ func TestIntegrationSignup(t *testing.T) {
 		_, err := h.Handle(ctx, users.SignupCommand{Email: "dup@example.com", Password: "correcthorse"})
 		require.NoError(t, err)
 
+		before := countOutbox(t, pool, events.UserSignedUpName)
 		_, err = h.Handle(ctx, users.SignupCommand{Email: "dup@example.com", Password: "correcthorse"})
 		require.Equal(t, apperrors.Conflict, apperrors.KindOf(err))
+		require.Equal(t, before, countOutbox(t, pool, events.UserSignedUpName),
+			"a signup that failed must announce nothing")
 	})
 
 	t.Run("rejects a short password", func(t *testing.T) {
@@ -117,6 +164,7 @@ func TestIntegrationChangePassword(t *testing.T) {
 			UserID: created.UserID, CurrentPassword: "wrong", NewPassword: "newpassword1",
 		})
 		require.Equal(t, apperrors.Unauthorized, apperrors.KindOf(err))
+		require.Zero(t, countOutbox(t, pool, events.PasswordChangedName))
 	})
 
 	t.Run("rotates the password", func(t *testing.T) {
@@ -129,6 +177,11 @@ func TestIntegrationChangePassword(t *testing.T) {
 
 		_, err = login.Handle(ctx, users.LoginCommand{Email: "pw@example.com", Password: "newpassword1"})
 		require.NoError(t, err)
+
+		evt, partitionKey := lastOutboxPayload[events.PasswordChanged](t, pool, events.PasswordChangedName)
+		require.Equal(t, created.UserID, evt.UserID)
+		require.Equal(t, created.UserID.String(), evt.DoneBy)
+		require.Equal(t, created.UserID.String(), partitionKey)
 	})
 
 	t.Run("unknown user is NotFound", func(t *testing.T) {
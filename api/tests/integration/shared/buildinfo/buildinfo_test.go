@@ -0,0 +1,51 @@
+package buildinfo_test
+
+import (
+	"context"
+	"testing"
+
+	"eventify/api/internal/shared/buildinfo"
+	"eventify/api/tests/integration/testsupport"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationRead_ReportsTheMigrationVersion(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	ctx := context.Background()
+
+	// testsupport applies migrations itself, so golang-migrate's table is
+	// not there yet: a database it never migrated.
+	info, err := buildinfo.Read(ctx, pool)
+	require.NoError(t, err)
+	require.Nil(t, info.MigrationVersion)
+	require.NotEmpty(t, info.Commit)
+
+	// Another module's migrations, in golang-migrate's default table, say
+	// nothing about the api's.
+	for _, stmt := range []string{
+		`CREATE TABLE schema_migrations (version bigint PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO schema_migrations VALUES (4, false)`,
+	} {
+		_, err = pool.Exec(ctx, stmt)
+		require.NoError(t, err)
+	}
+	info, err = buildinfo.Read(ctx, pool)
+	require.NoError(t, err)
+	require.Nil(t, info.MigrationVersion)
+
+	for _, stmt := range []string{
+		`CREATE TABLE ` + buildinfo.MigrationsTable + ` (version bigint PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO ` + buildinfo.MigrationsTable + ` VALUES (11, false)`,
+	} {
+		_, err = pool.Exec(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	info, err = buildinfo.Read(ctx, pool)
+	require.NoError(t, err)
+	require.NotNil(t, info.MigrationVersion)
+	require.EqualValues(t, 11, *info.MigrationVersion)
+	require.False(t, info.MigrationDirty)
+}
@@ -17,6 +17,8 @@ import (
 
 	"eventify/api/internal/domain"
 	"eventify/api/internal/features/events"
+	"eventify/api/internal/shared/auth"
+	"eventify/api/internal/transport/http/middleware"
 	v1events "eventify/api/internal/transport/http/v1/events"
 	"eventify/platform/apperrors"
 
@@ -25,12 +27,25 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// mount registers the controller on a bare app, bypassing JWT: authentication
-// is the middleware's job and is tested separately.
+// actor is the caller every request is made as.
+var actor = uuid.New()
+
+// actorProvider accepts any bearer token as actor's. Validating tokens is the
+// middleware's job and is tested separately; the adapter only reads the
+// claims it leaves behind.
+type actorProvider struct{ auth.IJWTProvider }
+
+func (actorProvider) ValidateToken(string) (*auth.CustomClaims, error) {
+	return &auth.CustomClaims{UserID: actor}, nil
+}
+
+// mount registers the controller on a bare app, behind a JWT middleware that
+// admits every request as actor.
 func mount(t *testing.T, h v1events.Handlers) *fiber.App {
 	t.Helper()
 	c := v1events.New(h)
 	app := fiber.New()
+	app.Use(middleware.JWT(actorProvider{}))
 	app.Get("/events", c.List)
 	app.Get("/events/:id", c.Get)
 	app.Put("/events/:id", c.Update)
@@ -47,6 +62,7 @@ func do(t *testing.T, app *fiber.App, method, target string, body any) *http.Res
 		r = bytes.NewReader(b)
 	}
 	req := httptest.NewRequest(method, target, r)
+	req.Header.Set("Authorization", "Bearer test")
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -150,6 +166,7 @@ func TestUpdate_PassesEveryFieldToTheCommand(t *testing.T) {
 	require.Equal(t, "c", got.Category)
 	require.Equal(t, []string{"t"}, got.Tags)
 	require.Equal(t, 1, got.Capacity)
+	require.Equal(t, actor, got.UpdatedBy, "the update is attributed to the caller")
 }
 
 func TestList_ForwardsPagingAndEncodesTotal(t *testing.T) {
@@ -192,10 +209,15 @@ func TestGet_UsesOrganizerSpelling(t *testing.T) {
 }
 
 func TestDelete_Returns204(t *testing.T) {
+	var got events.DeleteEventCommand
 	app := mount(t, v1events.Handlers{
-		Delete: func(context.Context, events.DeleteEventCommand) error { return nil },
+		Delete: func(_ context.Context, cmd events.DeleteEventCommand) error {
+			got = cmd
+			return nil
+		},
 	})
 
 	resp := do(t, app, http.MethodDelete, "/events/"+uuid.NewString(), nil)
 	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, actor, got.DeletedBy, "the deletion is attributed to the caller")
 }
@@ -18,6 +18,8 @@ import (
 
 	"eventify/api/internal/domain"
 	"eventify/api/internal/features/events"
+	"eventify/api/internal/shared/auth"
+	"eventify/api/internal/transport/http/middleware"
 	v2events "eventify/api/internal/transport/http/v2/events"
 	"eventify/platform/apperrors"
 
@@ -26,10 +28,21 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// actor is the caller every request is made as.
+var actor = uuid.New()
+
+// actorProvider accepts any bearer token as actor's, as in the v1 tests.
+type actorProvider struct{ auth.IJWTProvider }
+
+func (actorProvider) ValidateToken(string) (*auth.CustomClaims, error) {
+	return &auth.CustomClaims{UserID: actor}, nil
+}
+
 func mount(t *testing.T, h v2events.Handlers) *fiber.App {
 	t.Helper()
 	c := v2events.New(h)
 	app := fiber.New()
+	app.Use(middleware.JWT(actorProvider{}))
 	app.Get("/events", c.List)
 	app.Put("/events/:id", c.Update)
 	return app
@@ -44,6 +57,7 @@ func do(t *testing.T, app *fiber.App, method, target string, body any) *http.Res
 		r = bytes.NewReader(b)
 	}
 	req := httptest.NewRequest(method, target, r)
+	req.Header.Set("Authorization", "Bearer test")
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
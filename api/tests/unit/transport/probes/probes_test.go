@@ -0,0 +1,39 @@
+package probes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"eventify/api/internal/transport/probes"
+	"eventify/platform/health"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func check(t *testing.T, s *probes.GRPCServer, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	res, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return res.GetStatus()
+}
+
+func TestGRPCServer_AnswersReadinessAndLiveness(t *testing.T) {
+	h := health.New()
+	h.Ready("postgres", func(context.Context) error { return errors.New("connection refused") })
+	s := probes.NewGRPCServer(h, "eventify.EventService")
+
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, ""))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, "eventify.EventService"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, s, probes.LivenessService),
+		"a database outage must not fail liveness")
+}
+
+func TestGRPCServer_UnknownServiceIsNotFound(t *testing.T) {
+	s := probes.NewGRPCServer(health.New())
+	_, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "nope"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The headers an Envelope travels in. Traceparent is the W3C header the
+// telemetry package reads and writes; the rest are eventify's own.
+const (
+	HeaderName          = "eventify-name"
+	HeaderVersion       = "eventify-version"
+	HeaderMessageID     = "eventify-message-id"
+	HeaderOccurredAt    = "eventify-occurred-at"
+	HeaderProducer      = "eventify-producer"
+	HeaderTraceparent   = "traceparent"
+	HeaderCorrelationID = "eventify-correlation-id"
+)
+
+// Envelope is what a message says about itself, apart from its payload.
+//
+// It travels as AMQP headers beside the payload, not wrapped around it: a
+// payload stays the bare contract struct, so a consumer that predates the
+// envelope reads it as it always did. The envelope is optional for the same
+// reason. A message without one is routed by the key it was published under,
+// which is all there was before; one with an envelope is routed by its Name,
+// which survives what a routing key does not — a wildcard binding, a bridge
+// that republishes under its own key, a replay from a parking queue.
+//
+// Version is the contract version the payload was encoded against; see
+// Version. CorrelationID is shared by every message a single request led to,
+// however many hops apart; the first message of a chain correlates to itself.
+type Envelope struct {
+	OccurredAt    time.Time
+	Name          string
+	Producer      string
+	Traceparent   string
+	CorrelationID string
+	Version       int
+	MessageID     uuid.UUID
+}
+
+// Headers encodes e as AMQP header values, leaving out the fields it does
+// not set.
+func (e Envelope) Headers() map[string]string {
+	h := map[string]string{HeaderName: e.Name}
+	set := func(key, value string) {
+		if value != "" {
+			h[key] = value
+		}
+	}
+	if e.Version != 0 {
+		set(HeaderVersion, strconv.Itoa(e.Version))
+	}
+	if e.MessageID != uuid.Nil {
+		set(HeaderMessageID, e.MessageID.String())
+	}
+	if !e.OccurredAt.IsZero() {
+		set(HeaderOccurredAt, e.OccurredAt.UTC().Format(time.RFC3339Nano))
+	}
+	set(HeaderProducer, e.Producer)
+	set(HeaderTraceparent, e.Traceparent)
+	set(HeaderCorrelationID, e.CorrelationID)
+	return h
+}
+
+// ParseEnvelope decodes the envelope in a message's headers. It returns nil
+// and no error for a message that has none — no HeaderName — and an error
+// for one whose envelope is present but malformed, which no retry will fix.
+func ParseEnvelope(headers map[string]any) (*Envelope, error) {
+	name, _ := headers[HeaderName].(string)
+	if name == "" {
+		return nil, nil
+	}
+
+	e := &Envelope{Name: name}
+	e.Producer, _ = headers[HeaderProducer].(string)
+	e.Traceparent, _ = headers[HeaderTraceparent].(string)
+	e.CorrelationID, _ = headers[HeaderCorrelationID].(string)
+
+	if v, ok := headers[HeaderVersion].(string); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("envelope of %s: version %q is not a positive integer", name, v)
+		}
+		e.Version = n
+	}
+	if v, ok := headers[HeaderMessageID].(string); ok {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("envelope of %s: message id %q: %w", name, v, err)
+		}
+		e.MessageID = id
+	}
+	if v, ok := headers[HeaderOccurredAt].(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("envelope of %s: occurred at %q: %w", name, v, err)
+		}
+		e.OccurredAt = t
+	}
+	return e, nil
+}
+
+type envelopeKey struct{}
+
+// WithEnvelope returns ctx carrying the envelope of the message being handled.
+// It also makes the envelope's CorrelationID ctx's own, so a message enqueued
+// while handling this one joins its chain.
+func WithEnvelope(ctx context.Context, e *Envelope) context.Context {
+	ctx = context.WithValue(ctx, envelopeKey{}, e)
+	return WithCorrelationID(ctx, e.CorrelationID)
+}
+
+// EnvelopeFrom returns the envelope WithEnvelope stored in ctx, or nil.
+func EnvelopeFrom(ctx context.Context) *Envelope {
+	e, _ := ctx.Value(envelopeKey{}).(*Envelope)
+	return e
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns ctx carrying id as its correlation ID. An empty
+// id leaves ctx as it is.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID in ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
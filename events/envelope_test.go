@@ -0,0 +1,91 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/events"
+
+	"github.com/google/uuid"
+)
+
+// headers converts Envelope.Headers to the shape a consumer reads them in.
+func headers(e events.Envelope) map[string]any {
+	out := map[string]any{}
+	for k, v := range e.Headers() {
+		out[k] = v
+	}
+	return out
+}
+
+func TestEnvelope_RoundTripsThroughHeaders(t *testing.T) {
+	want := events.Envelope{
+		Name:          events.EventCreatedName,
+		Version:       1,
+		MessageID:     uuid.New(),
+		OccurredAt:    time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.UTC),
+		Producer:      "outbox-relay",
+		Traceparent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		CorrelationID: uuid.NewString(),
+	}
+
+	got, err := events.ParseEnvelope(headers(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || *got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestEnvelope_LeavesOutWhatIsNotSet(t *testing.T) {
+	h := events.Envelope{Name: events.EventDeletedName}.Headers()
+	if len(h) != 1 || h[events.HeaderName] != events.EventDeletedName {
+		t.Fatalf("got %v, want the name alone", h)
+	}
+}
+
+func TestParseEnvelope_IsOptional(t *testing.T) {
+	e, err := events.ParseEnvelope(map[string]any{"x-death": []any{}})
+	if err != nil || e != nil {
+		t.Fatalf("got %+v, %v; a message without an envelope has none, and is not an error", e, err)
+	}
+}
+
+func TestParseEnvelope_RejectsAMalformedEnvelope(t *testing.T) {
+	for _, h := range []map[string]any{
+		{events.HeaderName: "EventCreated", events.HeaderVersion: "two"},
+		{events.HeaderName: "EventCreated", events.HeaderVersion: "0"},
+		{events.HeaderName: "EventCreated", events.HeaderMessageID: "not-a-uuid"},
+		{events.HeaderName: "EventCreated", events.HeaderOccurredAt: "yesterday"},
+	} {
+		if _, err := events.ParseEnvelope(h); err == nil {
+			t.Errorf("%v: expected an error", h)
+		}
+	}
+}
+
+func TestWithEnvelope_CarriesItsCorrelationID(t *testing.T) {
+	e := &events.Envelope{Name: events.EventCreatedName, CorrelationID: "chain-1"}
+	ctx := events.WithEnvelope(context.Background(), e)
+
+	if events.EnvelopeFrom(ctx) != e {
+		t.Error("EnvelopeFrom must return the envelope stored")
+	}
+	if got := events.CorrelationID(ctx); got != "chain-1" {
+		t.Errorf("CorrelationID = %q, want chain-1", got)
+	}
+	if events.EnvelopeFrom(context.Background()) != nil {
+		t.Error("a bare context has no envelope")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	if got := events.Version(events.EventCreatedName); got != 1 {
+		t.Errorf("Version(EventCreated) = %d, want 1", got)
+	}
+	if got := events.Version("Ghost"); got != 0 {
+		t.Errorf("Version(Ghost) = %d, want 0", got)
+	}
+}
@@ -17,10 +17,48 @@
 //
 // Adding a field is safe: an old message simply leaves it zero. Renaming one
 // silently zeroes it on every message already queued, and nothing fails loudly.
+//
+// TestSchemaSnapshot fails loudly instead. Every contract is listed in this
+// package with its name, its JSON Schema is generated from the struct — see
+// SchemaFor — and a snapshot of every schema is committed under schemas/.
+// A contract that drops, renames or retypes a field relative to its snapshot
+// fails the test; one that only adds fields fails it too, until the snapshot
+// is regenerated with
+//
+//	go test ./events -run TestSchemaSnapshot -update
+//
+// A new contract must be added to the list in schema.go, or nothing checks it.
+//
+// # Breaking changes
+//
+// A change that cannot be additive — DoneBy renamed, Type given a new meaning —
+// is made as a new version of the contract rather than in place. The struct
+// changes; its version in schema.go goes up, and is sent in every message's
+// Envelope; and an upcast from the old version is registered in upcast.go,
+// which rewrites a payload in the old shape as the new one. A consumer runs
+// Upcast before it decodes, so a message enqueued before the change, replayed
+// from a parking queue or requeued from the outbox reads as if it had been
+// produced today.
+//
+// The old version's snapshot stays under schemas/, and TestSchemaSnapshot
+// fails while it has no upcast. TestUpcastGoldenFiles checks each upcast
+// against a hand-written pair of payloads under testdata/upcast.
 package events
 
+import "strings"
+
+// routingKeyPrefix namespaces every eventify routing key.
+const routingKeyPrefix = "eventify.events."
+
 // RoutingKey is the AMQP routing key for a given event name, e.g.
 // "eventify.events.EventCreated". The relay publishes under it and subscribers
 // bind their queue to it, both through this function, so the two cannot drift
 // apart.
-func RoutingKey(name string) string { return "eventify.events." + name }
+func RoutingKey(name string) string { return routingKeyPrefix + name }
+
+// NameFromRoutingKey is the inverse of RoutingKey. It reports false for a key
+// RoutingKey could not have produced.
+func NameFromRoutingKey(key string) (string, bool) {
+	name, ok := strings.CutPrefix(key, routingKeyPrefix)
+	return name, ok && name != ""
+}
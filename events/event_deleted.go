@@ -0,0 +1,21 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventDeletedName identifies the EventDeleted contract, for the same reason
+// EventCreatedName does.
+const EventDeletedName = "EventDeleted"
+
+// EventDeleted is published when an event is deleted via any transport. The
+// event is gone by the time it is consumed, so it carries only the event's ID
+// and who deleted it.
+type EventDeleted struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	MessageID  uuid.UUID `json:"message_id"`
+	ID         uuid.UUID `json:"id"`
+	DoneBy     string    `json:"done_by"`
+}
@@ -0,0 +1,31 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventUpdatedName identifies the EventUpdated contract, for the same reason
+// EventCreatedName does.
+const EventUpdatedName = "EventUpdated"
+
+// EventUpdated is published when an update changes at least one of an event's
+// fields, via any transport. An update that changes nothing publishes nothing.
+//
+// Name and Type are the event's values after the update, whether or not they
+// changed, so a consumer that only keeps those need not look anything up.
+// ChangedFields names every field the update changed, by its column name:
+// name, description, location, date, organizer, category, tags or capacity.
+//
+// DoneBy is the user who made the update. MessageID is the deduplication key,
+// as on EventCreated.
+type EventUpdated struct {
+	OccurredAt    time.Time `json:"occurred_at"`
+	MessageID     uuid.UUID `json:"message_id"`
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	ChangedFields []string  `json:"changed_fields"`
+	DoneBy        string    `json:"done_by"`
+}
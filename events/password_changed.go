@@ -0,0 +1,24 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasswordChangedName identifies the PasswordChanged contract, for the same
+// reason EventCreatedName does.
+const PasswordChangedName = "PasswordChanged"
+
+// PasswordChanged is published when a user's password is replaced, so that
+// they can be told about a change they did not make. It carries neither the
+// old password nor the new one.
+//
+// DoneBy is who made the change: the user themselves, for a change that proved
+// the old password.
+type PasswordChanged struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	MessageID  uuid.UUID `json:"message_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	DoneBy     string    `json:"done_by"`
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoleAssignedName identifies the RoleAssigned contract, for the same reason
+// EventCreatedName does.
+const RoleAssignedName = "RoleAssigned"
+
+// RoleAssigned is published when a user is granted a role they did not
+// already hold. Granting a role twice publishes it once.
+//
+// RoleName is the role's name at the time of the grant, so a consumer need not
+// look it up. DoneBy is the administrator who granted it.
+type RoleAssigned struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	MessageID  uuid.UUID `json:"message_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	RoleID     uuid.UUID `json:"role_id"`
+	RoleName   string    `json:"role_name"`
+	DoneBy     string    `json:"done_by"`
+}
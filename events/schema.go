@@ -0,0 +1,223 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// contract is one payload type, and the version of it this binary encodes.
+type contract struct {
+	typ     reflect.Type
+	version int
+}
+
+// contracts maps every event name to its payload type. It is the list the
+// schema snapshot is generated from, so a contract missing here is a contract
+// nothing checks.
+var contracts = map[string]contract{
+	EventCreatedName:    {reflect.TypeFor[EventCreated](), 1},
+	EventUpdatedName:    {reflect.TypeFor[EventUpdated](), 1},
+	EventDeletedName:    {reflect.TypeFor[EventDeleted](), 1},
+	UserSignedUpName:    {reflect.TypeFor[UserSignedUp](), 1},
+	RoleAssignedName:    {reflect.TypeFor[RoleAssigned](), 1},
+	PasswordChangedName: {reflect.TypeFor[PasswordChanged](), 1},
+}
+
+// Names lists every contract in this package, sorted.
+func Names() []string {
+	names := make([]string, 0, len(contracts))
+	for name := range contracts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Version is the version of the contract registered as name that this
+// binary's struct encodes, or 0 for a name with no contract. It is sent in a
+// message's Envelope, so a consumer knows which shape it is reading. An
+// additive change, the only kind the package doc allows in place, does not
+// need a new version.
+func Version(name string) int { return contracts[name].version }
+
+// Schema is the subset of JSON Schema the contracts need: objects of typed
+// properties, arrays of them, and the formats of the string-encoded types.
+type Schema struct {
+	Schema     string             `json:"$schema,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	// AdditionalProperties is the schema of a map's values.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+// SchemaFor generates the JSON Schema of the contract registered as name,
+// from the struct and its json tags — the same tags encoding/json reads, so
+// the schema describes what is actually on the wire.
+func SchemaFor(name string) (*Schema, error) {
+	c, ok := contracts[name]
+	if !ok {
+		return nil, fmt.Errorf("no contract named %s", name)
+	}
+	s, err := schemaOf(c.typ)
+	if err != nil {
+		return nil, fmt.Errorf("schema for %s: %w", name, err)
+	}
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = name
+	return s, nil
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	uuidType = reflect.TypeFor[uuid.UUID]()
+)
+
+func schemaOf(t reflect.Type) (*Schema, error) {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes a []byte as a base64 string.
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key %s is not a string", t.Key())
+		}
+		values, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema describes t's exported fields. Contracts are flat structs; an
+// embedded one would need encoding/json's promotion rules, and is refused
+// rather than described wrongly.
+func structSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous {
+			return nil, fmt.Errorf("%s embeds %s; contracts must be flat", t, f.Type)
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop, err := schemaOf(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		s.Properties[name] = prop
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+	slices.Sort(s.Required)
+	return s, nil
+}
+
+// Incompatibilities lists every way a message encoded against old would be
+// read wrongly as next: a property old has that next lacks — removed, or
+// renamed, which looks the same on the wire — or one whose type or format
+// changed. Nested objects, array items and map values are compared the same
+// way. A property next adds is compatible, and not reported.
+//
+// Each entry names the property by its path from the root, e.g. "tags[]".
+func Incompatibilities(old, next *Schema) []string {
+	var out []string
+	incompatibilities("", old, next, &out)
+	return out
+}
+
+func incompatibilities(path string, old, next *Schema, out *[]string) {
+	at := path
+	if at == "" {
+		at = "(root)"
+	}
+	if old.Type != next.Type || old.Format != next.Format {
+		*out = append(*out, fmt.Sprintf("%s: type changed from %s to %s", at, describe(old), describe(next)))
+		return
+	}
+
+	for _, name := range sortedKeys(old.Properties) {
+		p := join(path, name)
+		nextProp, ok := next.Properties[name]
+		if !ok {
+			*out = append(*out, fmt.Sprintf("%s: removed or renamed", p))
+			continue
+		}
+		incompatibilities(p, old.Properties[name], nextProp, out)
+	}
+	if old.Items != nil && next.Items != nil {
+		incompatibilities(path+"[]", old.Items, next.Items, out)
+	}
+	if old.AdditionalProperties != nil && next.AdditionalProperties != nil {
+		incompatibilities(path+"{}", old.AdditionalProperties, next.AdditionalProperties, out)
+	}
+}
+
+func describe(s *Schema) string {
+	if s.Format != "" {
+		return s.Type + " (" + s.Format + ")"
+	}
+	return s.Type
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,224 @@
+package events_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"eventify/events"
+)
+
+// update rewrites the snapshot in schemas/ from the contracts, once every
+// change is known to be compatible:
+//
+//	go test ./events -run TestSchemaSnapshot -update
+var update = flag.Bool("update", false, "rewrite schemas/ from the contracts")
+
+const snapshotDir = "schemas"
+
+// snapshotPath is where the schema of version of the contract name is kept.
+// Every version has its own: the current one is what the contract encodes,
+// and an earlier one is what a message still in flight may carry.
+func snapshotPath(name string, version int) string {
+	return filepath.Join(snapshotDir, fmt.Sprintf("%s.v%d.json", name, version))
+}
+
+func encode(t *testing.T, s *events.Schema) []byte {
+	t.Helper()
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		t.Fatalf("encode schema: %v", err)
+	}
+	return append(b, '\n')
+}
+
+type snapshot struct {
+	name    string
+	version int
+}
+
+// snapshotted lists the contract versions schemas/ has a snapshot of.
+func snapshotted(t *testing.T) []snapshot {
+	t.Helper()
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read %s: %v", snapshotDir, err)
+	}
+	var out []snapshot
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		name, v, ok := strings.Cut(base, ".v")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			t.Errorf("%s: want a name of the form <contract>.v<version>.json", e.Name())
+			continue
+		}
+		out = append(out, snapshot{name, version})
+	}
+	return out
+}
+
+// TestSchemaSnapshot holds every contract to the rule in the package doc:
+// field changes must be additive. A message already in a queue was encoded
+// against the snapshot of its version, and is about to be decoded by the
+// contract as it is now; a field it carries that the contract no longer has
+// is silently zeroed.
+//
+// A change that cannot be additive moves the contract to a new version, which
+// starts a snapshot of its own. The old snapshot stays, and the test then
+// requires an upcast from the old version — see Upcast — so that the messages
+// in flight can still be read.
+//
+// -update cannot get a breaking change past it. The snapshot is only rewritten
+// once the contracts are compatible with it, so a break without a new version
+// means deleting the snapshot by hand, where a reviewer sees it.
+func TestSchemaSnapshot(t *testing.T) {
+	for _, s := range snapshotted(t) {
+		current := events.Version(s.name)
+		switch {
+		case current == 0:
+			t.Errorf("%s has a snapshot but no contract; messages in flight still carry it", s.name)
+		case s.version > current:
+			t.Errorf("%s has a snapshot of version %d, ahead of the contract's version %d", s.name, s.version, current)
+		case !events.CanUpcast(s.name, s.version):
+			t.Errorf("%s version %d has a snapshot but no upcast to version %d; messages in flight at version %d cannot be read",
+				s.name, s.version, current, s.version)
+		}
+	}
+
+	for _, name := range events.Names() {
+		t.Run(name, func(t *testing.T) {
+			current, err := events.SchemaFor(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := encode(t, current)
+			path := snapshotPath(name, events.Version(name))
+
+			got, err := os.ReadFile(path)
+			switch {
+			case os.IsNotExist(err):
+				if !*update {
+					t.Fatalf("no snapshot of %s; run go test ./events -run TestSchemaSnapshot -update", path)
+				}
+			case err != nil:
+				t.Fatal(err)
+			default:
+				var snapshot events.Schema
+				if err := json.Unmarshal(got, &snapshot); err != nil {
+					t.Fatalf("decode %s: %v", path, err)
+				}
+				if problems := events.Incompatibilities(&snapshot, current); len(problems) > 0 {
+					t.Fatalf("%s changed incompatibly with %s; field changes must be additive:\n\t%s",
+						name, path, strings.Join(problems, "\n\t"))
+				}
+				if bytes.Equal(got, want) {
+					return
+				}
+				if !*update {
+					t.Fatalf("%s is out of date; run go test ./events -run TestSchemaSnapshot -update", path)
+				}
+			}
+
+			if err := os.MkdirAll(snapshotDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSchemaFor_DescribesTheWireFormat(t *testing.T) {
+	s, err := events.SchemaFor(events.EventUpdatedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Properties["message_id"]; got == nil || got.Type != "string" || got.Format != "uuid" {
+		t.Errorf("message_id = %+v, want a uuid string", got)
+	}
+	if got := s.Properties["occurred_at"]; got == nil || got.Format != "date-time" {
+		t.Errorf("occurred_at = %+v, want a date-time string", got)
+	}
+	if got := s.Properties["changed_fields"]; got == nil || got.Type != "array" || got.Items.Type != "string" {
+		t.Errorf("changed_fields = %+v, want an array of strings", got)
+	}
+	if _, ok := s.Properties["ChangedFields"]; ok {
+		t.Error("properties are named by json tag, not by Go field")
+	}
+}
+
+func TestSchemaFor_RejectsAnUnknownContract(t *testing.T) {
+	if _, err := events.SchemaFor("Ghost"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func object(props map[string]*events.Schema) *events.Schema {
+	return &events.Schema{Type: "object", Properties: props}
+}
+
+var (
+	str     = &events.Schema{Type: "string"}
+	integer = &events.Schema{Type: "integer"}
+	id      = &events.Schema{Type: "string", Format: "uuid"}
+)
+
+func TestIncompatibilities(t *testing.T) {
+	old := object(map[string]*events.Schema{
+		"id":   id,
+		"name": str,
+		"tags": {Type: "array", Items: str},
+	})
+
+	for _, c := range []struct {
+		desc string
+		next *events.Schema
+		want []string
+	}{
+		{"unchanged", old, nil},
+		{
+			"a field added",
+			object(map[string]*events.Schema{"id": id, "name": str, "tags": {Type: "array", Items: str}, "extra": integer}),
+			nil,
+		},
+		{
+			"a field renamed",
+			object(map[string]*events.Schema{"id": id, "title": str, "tags": {Type: "array", Items: str}}),
+			[]string{"name: removed or renamed"},
+		},
+		{
+			"a type changed",
+			object(map[string]*events.Schema{"id": id, "name": integer, "tags": {Type: "array", Items: str}}),
+			[]string{"name: type changed from string to integer"},
+		},
+		{
+			"a format changed",
+			object(map[string]*events.Schema{"id": str, "name": str, "tags": {Type: "array", Items: str}}),
+			[]string{"id: type changed from string (uuid) to string"},
+		},
+		{
+			"an array's items changed",
+			object(map[string]*events.Schema{"id": id, "name": str, "tags": {Type: "array", Items: integer}}),
+			[]string{"tags[]: type changed from string to integer"},
+		},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			if got := events.Incompatibilities(old, c.next); !slices.Equal(got, c.want) {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
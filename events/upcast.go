@@ -0,0 +1,95 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// UpcastFunc rewrites a payload encoded against one version of a contract as
+// the next version, in place: renaming a field, changing its type, filling in
+// one the old version did not have.
+//
+// It works on the decoded top level rather than on a struct, because the old
+// version's struct no longer exists — that is why it needs an upcast.
+type UpcastFunc func(payload map[string]json.RawMessage) error
+
+// Upcasters holds every upcast of every contract, by contract name and then by
+// the version each one upcasts from. Upcasting from version n to version m
+// runs the upcasts from n, n+1, … m-1 in turn.
+type Upcasters map[string]map[int]UpcastFunc
+
+// upcasters is every upcast this package registers. There are none yet: every
+// contract is still at version 1.
+//
+// A contract that needs a change the package doc forbids making in place gets
+// a new version instead. Bump it in contracts, register the upcast from the
+// version before here, and add its golden files under testdata/upcast; see
+// TestUpcastGoldenFiles.
+var upcasters = Upcasters{}
+
+// Upcast rewrites a payload of the contract name, encoded against version,
+// as the version this binary decodes. A payload already at that version is
+// returned as it is, byte for byte.
+//
+// Version 0 means the version is not known — the message came without an
+// envelope — and the payload is taken to be current, which is what every
+// message was before contracts had versions.
+func Upcast(name string, version int, payload []byte) ([]byte, error) {
+	return upcasters.Upcast(name, payload, version, Version(name))
+}
+
+// CanUpcast reports whether a payload of the contract name at version can be
+// upcast to the current version.
+func CanUpcast(name string, version int) bool {
+	return upcasters.Covers(name, version, Version(name))
+}
+
+// Upcast rewrites payload from version from of the contract name to version
+// to. See the package-level Upcast for how versions 0 and to are treated.
+//
+// A payload newer than to is an error: it was produced by a binary that knows
+// a version this one does not, and cannot be read until this one is deployed.
+func (u Upcasters) Upcast(name string, payload []byte, from, to int) ([]byte, error) {
+	if from == 0 || to == 0 || from == to {
+		return payload, nil
+	}
+	if from > to {
+		return nil, fmt.Errorf("%s payload is version %d; this binary reads up to version %d", name, from, to)
+	}
+	if !u.Covers(name, from, to) {
+		return nil, fmt.Errorf("no upcast of %s from version %d to %d", name, from, to)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("upcast %s payload: %w", name, err)
+	}
+	for v := from; v < to; v++ {
+		if err := u[name][v](fields); err != nil {
+			return nil, fmt.Errorf("upcast %s from version %d: %w", name, v, err)
+		}
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("upcast %s payload: %w", name, err)
+	}
+	return out, nil
+}
+
+// Covers reports whether u can upcast a payload from version from of the
+// contract name to version to: whether it has every upcast between them, with
+// versions 0 and to treated as Upcast treats them.
+func (u Upcasters) Covers(name string, from, to int) bool {
+	if from == 0 || to == 0 {
+		return true
+	}
+	if from > to {
+		return false
+	}
+	for v := from; v < to; v++ {
+		if u[name][v] == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestUpcastGoldenFiles checks every registered upcast against golden files
+// under testdata/upcast/<contract>/: v<n>.json is a payload as version n
+// encoded it, and each upcast from n must turn it into v<n+1>.json. The file
+// of the current version must decode into the contract's struct with no field
+// left over, and every older file must upcast all the way to it.
+//
+// The files are written by hand, not generated: each is its author's
+// statement of what a message in flight becomes, for a reviewer to check.
+func TestUpcastGoldenFiles(t *testing.T) {
+	checkGoldenFiles(t, upcasters, filepath.Join("testdata", "upcast"), func(name string) (reflect.Type, int) {
+		c := contracts[name]
+		return c.typ, c.version
+	})
+}
+
+// exampleV3 is a contract as it might be after two breaking changes: version
+// 2 renamed done_by to created_by, and version 3 made tags, once a
+// comma-separated string, an array.
+type exampleV3 struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	MessageID  uuid.UUID `json:"message_id"`
+	CreatedBy  string    `json:"created_by"`
+	Tags       []string  `json:"tags"`
+}
+
+var exampleUpcasters = Upcasters{"Example": {
+	1: func(p map[string]json.RawMessage) error {
+		p["created_by"] = p["done_by"]
+		delete(p, "done_by")
+		return nil
+	},
+	2: func(p map[string]json.RawMessage) error {
+		var tags string
+		if err := json.Unmarshal(p["tags"], &tags); err != nil {
+			return fmt.Errorf("tags: %w", err)
+		}
+		split := []string{}
+		if tags != "" {
+			split = strings.Split(tags, ",")
+		}
+		b, err := json.Marshal(split)
+		p["tags"] = b
+		return err
+	},
+}}
+
+// TestUpcastGoldenFiles_Example runs the golden file check over a registry of
+// its own, so the check is itself checked while the package has no upcasts.
+func TestUpcastGoldenFiles_Example(t *testing.T) {
+	checkGoldenFiles(t, exampleUpcasters, filepath.Join("testdata", "upcast-example"), func(string) (reflect.Type, int) {
+		return reflect.TypeFor[exampleV3](), 3
+	})
+}
+
+func checkGoldenFiles(t *testing.T, u Upcasters, dir string, current func(name string) (reflect.Type, int)) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if _, ok := u[e.Name()]; !ok {
+			t.Errorf("%s has golden files but no upcasts", filepath.Join(dir, e.Name()))
+		}
+	}
+
+	for name, steps := range u {
+		t.Run(name, func(t *testing.T) {
+			typ, version := current(name)
+			golden := func(v int) []byte {
+				t.Helper()
+				b, err := os.ReadFile(filepath.Join(dir, name, fmt.Sprintf("v%d.json", v)))
+				if err != nil {
+					t.Fatalf("golden file for %s version %d: %v", name, v, err)
+				}
+				return b
+			}
+
+			for from := range steps {
+				got, err := u.Upcast(name, golden(from), from, from+1)
+				if err != nil {
+					t.Fatalf("upcast from version %d: %v", from, err)
+				}
+				requireSameJSON(t, fmt.Sprintf("upcast from version %d", from), golden(from+1), got)
+
+				all, err := u.Upcast(name, golden(from), from, version)
+				if err != nil {
+					t.Fatalf("upcast from version %d to %d: %v", from, version, err)
+				}
+				requireSameJSON(t, fmt.Sprintf("upcast from version %d to %d", from, version), golden(version), all)
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(golden(version)))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(reflect.New(typ).Interface()); err != nil {
+				t.Errorf("version %d golden file does not decode into %s: %v", version, typ, err)
+			}
+		})
+	}
+}
+
+func requireSameJSON(t *testing.T, what string, want, got []byte) {
+	t.Helper()
+	var w, g any
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("%s: golden file: %v", what, err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: result: %v", what, err)
+	}
+	if !reflect.DeepEqual(w, g) {
+		t.Fatalf("%s:\n got: %s\nwant: %s", what, got, bytes.TrimSpace(want))
+	}
+}
@@ -0,0 +1,80 @@
+package events_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"eventify/events"
+)
+
+var renameDoneBy = events.Upcasters{"Example": {
+	1: func(p map[string]json.RawMessage) error {
+		p["created_by"] = p["done_by"]
+		delete(p, "done_by")
+		return nil
+	},
+}}
+
+func TestUpcasters_UpcastRunsEachStep(t *testing.T) {
+	got, err := renameDoneBy.Upcast("Example", []byte(`{"done_by":"u1"}`), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"created_by":"u1"}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+// A current payload must come back untouched: re-encoding it would reorder its
+// fields at best, and drop what this binary does not know at worst.
+func TestUpcasters_LeavesACurrentPayloadAlone(t *testing.T) {
+	payload := []byte(`{ "z": 1, "a": 2 }`)
+	for _, from := range []int{0, 2} {
+		got, err := renameDoneBy.Upcast("Example", payload, from, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(payload) {
+			t.Errorf("from version %d: got %s, want the payload as it was", from, got)
+		}
+	}
+}
+
+func TestUpcasters_RejectsWhatItCannotUpcast(t *testing.T) {
+	for _, c := range []struct {
+		desc     string
+		from, to int
+		want     string
+	}{
+		{"a version newer than this binary's", 3, 2, "reads up to version 2"},
+		{"a missing step", 1, 3, "no upcast of Example from version 1 to 3"},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			_, err := renameDoneBy.Upcast("Example", []byte(`{}`), c.from, c.to)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestUpcasters_Covers(t *testing.T) {
+	if !renameDoneBy.Covers("Example", 1, 2) || !renameDoneBy.Covers("Example", 0, 2) {
+		t.Error("version 1 and an unknown version both reach version 2")
+	}
+	if renameDoneBy.Covers("Example", 1, 3) || renameDoneBy.Covers("Example", 3, 2) {
+		t.Error("a missing step, or a newer version, cannot be upcast")
+	}
+}
+
+// Every contract is at version 1 today, so there is nothing to upcast.
+func TestUpcast_LeavesEveryCurrentContractAlone(t *testing.T) {
+	for _, name := range events.Names() {
+		payload := []byte(`{"message_id":"x"}`)
+		got, err := events.Upcast(name, events.Version(name), payload)
+		if err != nil || string(got) != string(payload) {
+			t.Errorf("%s: got %s, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSignedUpName identifies the UserSignedUp contract, for the same reason
+// EventCreatedName does.
+const UserSignedUpName = "UserSignedUp"
+
+// UserSignedUp is published when an account is created through signup.
+//
+// It carries what a welcome email needs — the address and the name to greet —
+// and never the password or its hash. UserID is the new account's ID.
+// MessageID is the deduplication key, as on EventCreated.
+type UserSignedUp struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	MessageID  uuid.UUID `json:"message_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Email      string    `json:"email"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+}
@@ -0,0 +1,286 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eventify/events"
+	"eventify/platform/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// The functions in this file are for operators, not the relay. They back
+// cmd/outboxctl, so that inspecting and resetting a stalled outbox goes through
+// the same Status constants the relay writes rather than hand-typed integers.
+
+// ParseStatus is the inverse of Status.String, ignoring case.
+func ParseStatus(s string) (Status, error) {
+	for _, st := range []Status{Queued, Poisoned, Completed, Exceeded} {
+		if strings.EqualFold(s, st.String()) {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown outbox status %q", s)
+}
+
+// Filter selects outbox rows. Zero fields do not filter: the zero Filter
+// matches every row.
+//
+// Since and Until bound occurred_at, inclusive and exclusive respectively.
+type Filter struct {
+	Since       time.Time
+	Until       time.Time
+	PayloadType string
+	Statuses    []Status
+	MessageIDs  []uuid.UUID
+	// Limit caps List. Requeue ignores it: a partial reset would leave an
+	// operator guessing which rows it reached.
+	Limit int
+}
+
+// where renders f as a SQL predicate and its arguments, numbering placeholders
+// after any the caller has already bound.
+func (f Filter) where(args []any) (string, []any) {
+	var conds []string
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if len(f.Statuses) > 0 {
+		statuses := make([]int16, len(f.Statuses))
+		for i, s := range f.Statuses {
+			statuses[i] = int16(s)
+		}
+		add("status = ANY($%d)", statuses)
+	}
+	if f.PayloadType != "" {
+		add("payload_type = $%d", f.PayloadType)
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < $%d", f.Until)
+	}
+	if len(f.MessageIDs) > 0 {
+		ids := make([]string, len(f.MessageIDs))
+		for i, id := range f.MessageIDs {
+			ids[i] = id.String()
+		}
+		add("message_id = ANY($%d::uuid[])", ids)
+	}
+
+	if len(conds) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// List returns the rows matching f, oldest first.
+func List(ctx context.Context, q postgres.Querier, f Filter) ([]Message, error) {
+	where, args := f.where(nil)
+	sql := `SELECT ` + columns + ` FROM outbox_messages WHERE ` + where + ` ORDER BY occurred_at`
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		sql += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Requeue returns POISONED and EXCEEDED rows matching f to the queue, with
+// their attempts reset and claimable at once. It reports how many rows moved.
+//
+// It is the package doc's recovery UPDATE with a filter on it. Asking for any
+// other status is an error rather than a silent no-op: a QUEUED row is already
+// queued, and a COMPLETED one was published and must not be sent again by
+// accident. With no statuses in f, both stalled states are requeued.
+//
+// A row enqueued at an older version of its contract is upcast first — see
+// events.Upcast — so that it is published in the shape consumers decode
+// today, even one that reads no envelope. A row that cannot be upcast fails
+// the whole requeue, naming it. q should be a transaction, so that a failed
+// requeue leaves no row rewritten.
+func Requeue(ctx context.Context, q postgres.Querier, f Filter) (int64, error) {
+	if len(f.Statuses) == 0 {
+		f.Statuses = []Status{Poisoned, Exceeded}
+	}
+	for _, s := range f.Statuses {
+		if s != Poisoned && s != Exceeded {
+			return 0, fmt.Errorf("cannot requeue %s messages: only %s and %s can be requeued", s, Poisoned, Exceeded)
+		}
+	}
+
+	if err := upcastStale(ctx, q, f); err != nil {
+		return 0, err
+	}
+
+	where, args := f.where([]any{Queued})
+	tag, err := q.Exec(ctx,
+		`UPDATE outbox_messages
+		    SET status = $1, attempts = 0, next_attempt_at = now()
+		  WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("requeue outbox messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// upcastStale rewrites every row matching f whose payload is older than its
+// contract's current version as the current version.
+func upcastStale(ctx context.Context, q postgres.Querier, f Filter) error {
+	type stale struct {
+		id          uuid.UUID
+		messageID   uuid.UUID
+		payloadType string
+		payload     []byte
+		version     int
+	}
+
+	where, args := f.where(nil)
+	rows, err := q.Query(ctx,
+		`SELECT id, message_id, payload_type, payload, COALESCE(payload_version, 1)
+		   FROM outbox_messages WHERE `+where+` FOR UPDATE`, args...)
+	if err != nil {
+		return fmt.Errorf("find outbox messages to upcast: %w", err)
+	}
+	var found []stale
+	for rows.Next() {
+		var s stale
+		if err := rows.Scan(&s.id, &s.messageID, &s.payloadType, &s.payload, &s.version); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan outbox message to upcast: %w", err)
+		}
+		if s.version < events.Version(s.payloadType) {
+			found = append(found, s)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("find outbox messages to upcast: %w", err)
+	}
+
+	for _, s := range found {
+		current := events.Version(s.payloadType)
+		payload, err := events.Upcast(s.payloadType, s.version, s.payload)
+		if err != nil {
+			return fmt.Errorf("upcast outbox message %s: %w", s.messageID, err)
+		}
+		if _, err := q.Exec(ctx,
+			`UPDATE outbox_messages SET payload = $2, payload_version = $3 WHERE id = $1`,
+			s.id, payload, current); err != nil {
+			return fmt.Errorf("save upcast outbox message %s: %w", s.messageID, err)
+		}
+	}
+	return nil
+}
+
+// ArchiveCompleted moves up to limit COMPLETED rows that completed before
+// cutoff into outbox_messages_archive, oldest first, and reports how many it
+// moved. Call it repeatedly to drain a large table in bounded batches.
+//
+// The move is one statement, so a row is never in both tables or neither. Rows
+// are claimed with SKIP LOCKED, so an archive pass never waits on a relay.
+// A moved row's failure history is deleted with it: once a message has
+// published, why its earlier attempts failed is no longer anyone's problem.
+// Every other column an operator reads is carried over; a migration that adds
+// one to outbox_messages adds it to the archive too.
+func ArchiveCompleted(ctx context.Context, q postgres.Querier, cutoff time.Time, limit int) (int64, error) {
+	tag, err := q.Exec(ctx,
+		`WITH moved AS (
+		     DELETE FROM outbox_messages
+		      WHERE id IN (SELECT id
+		                     FROM outbox_messages
+		                    WHERE status = $1 AND completed_at < $2
+		                    ORDER BY completed_at
+		                    LIMIT $3
+		                      FOR UPDATE SKIP LOCKED)
+		  RETURNING id, message_id, payload_type, payload, occurred_at, completed_at, attempts,
+		            partition_key, traceparent, correlation_id, payload_version
+		 )
+		 INSERT INTO outbox_messages_archive
+		     (id, message_id, payload_type, payload, occurred_at, completed_at, attempts,
+		      partition_key, traceparent, correlation_id, payload_version)
+		 SELECT id, message_id, payload_type, payload, occurred_at, completed_at, attempts,
+		        partition_key, traceparent, correlation_id, payload_version
+		   FROM moved`,
+		Completed, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("archive completed outbox messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// EnsureArchivePartitions creates a monthly archive partition for every month
+// an archive up to cutoff could move rows into — from the oldest COMPLETED row
+// before cutoff through cutoff's own month — and for the month after, so it
+// exists before the cutoff crosses into it. Call it before ArchiveCompleted;
+// see EnsureArchivePartition for why.
+//
+// It tries every month, and returns the errors of the ones it could not
+// create, joined.
+func EnsureArchivePartitions(ctx context.Context, q postgres.Querier, cutoff time.Time) error {
+	var oldest *time.Time
+	if err := q.QueryRow(ctx,
+		`SELECT min(completed_at) FROM outbox_messages WHERE status = $1 AND completed_at < $2`,
+		Completed, cutoff).Scan(&oldest); err != nil {
+		return fmt.Errorf("find oldest completed row: %w", err)
+	}
+
+	from := cutoff
+	if oldest != nil {
+		from = *oldest
+	}
+	month := time.Date(from.UTC().Year(), from.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	var errs []error
+	for ; !month.After(cutoff.AddDate(0, 1, 0)); month = month.AddDate(0, 1, 0) {
+		if err := EnsureArchivePartition(ctx, q, month); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EnsureArchivePartition creates the monthly partition of
+// outbox_messages_archive that holds rows completed in month's calendar month
+// (UTC), if it does not already exist.
+//
+// Create a month's partition before any of its rows are archived. Rows that
+// arrive first land in the default partition, and Postgres then refuses to
+// create the month's partition until they are moved out of it by hand.
+func EnsureArchivePartition(ctx context.Context, q postgres.Querier, month time.Time) error {
+	from := time.Date(month.UTC().Year(), month.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	name := pgx.Identifier{fmt.Sprintf("outbox_messages_archive_%04d_%02d", from.Year(), from.Month())}
+
+	// DDL takes no bind parameters. Both values are formatted here from a
+	// time.Time, never from input.
+	_, err := q.Exec(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF outbox_messages_archive
+		 FOR VALUES FROM ('%s') TO ('%s')`,
+		name.Sanitize(), from.Format(time.RFC3339), to.Format(time.RFC3339)))
+	if err != nil {
+		return fmt.Errorf("create archive partition %s: %w", name.Sanitize(), err)
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+// Command outboxctl inspects and repairs the transactional outbox.
+//
+//	outboxctl list    [filters] [-limit N]
+//	outboxctl show    MESSAGE_ID
+//	outboxctl requeue [filters] [-all] [-dry-run]
+//	outboxctl archive -older-than 720h [-batch N] [-dry-run]
+//
+// Filters are -status, -type, -since, -until and -id. -status and -id take
+// comma-separated lists; -since and -until take an RFC 3339 time or a duration
+// meaning that long ago, so `-since 2h` is the last two hours.
+//
+// It connects with the same DB_* environment as the relay. Every change runs in
+// one transaction; -dry-run runs the very same statements and rolls back, so
+// the count it prints is the count a real run would produce.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"eventify/outbox"
+	"eventify/platform/cli"
+	"eventify/platform/config"
+	"eventify/platform/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const usage = `usage: outboxctl <command> [flags]
+
+commands:
+  list      list messages matching the filters
+  show      print one message, its payload and its failure history
+  requeue   return POISONED or EXCEEDED messages to the queue
+  archive   move old COMPLETED messages to outbox_messages_archive
+
+Run 'outboxctl <command> -h' for a command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var run func(context.Context, []string) error
+	switch os.Args[1] {
+	case "list":
+		run = list
+	case "show":
+		run = show
+	case "requeue":
+		run = requeue
+	case "archive":
+		run = archive
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := run(ctx, os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, cli.ErrUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// connect is called by each command once its flags have parsed, so that -h and
+// a usage error never need database credentials.
+func connect(ctx context.Context) (*pgxpool.Pool, error) {
+	dbPassword, err := config.MustString("DB_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	dsn := postgres.DSN(
+		config.String("DB_HOST", "localhost"),
+		config.String("DB_PORT", "5432"),
+		config.String("DB_USER", "postgres"),
+		dbPassword,
+		config.String("DB_NAME", "eventify"),
+		config.String("DB_SSLMODE", "disable"),
+	)
+	return postgres.NewPool(ctx, dsn)
+}
+
+// filterFlags registers the shared filter flags on fs and returns a function
+// that builds the Filter once fs has been parsed.
+func filterFlags(fs *flag.FlagSet) func() (outbox.Filter, error) {
+	status := fs.String("status", "", "comma-separated statuses, e.g. POISONED,EXCEEDED")
+	payloadType := fs.String("type", "", "payload type, e.g. EventCreated")
+	since := fs.String("since", "", "occurred at or after: RFC 3339 time, or a duration ago")
+	until := fs.String("until", "", "occurred before: RFC 3339 time, or a duration ago")
+	ids := fs.String("id", "", "comma-separated message IDs")
+
+	return func() (f outbox.Filter, err error) {
+		f.PayloadType = *payloadType
+		for _, s := range cli.SplitList(*status) {
+			st, err := outbox.ParseStatus(s)
+			if err != nil {
+				return f, fmt.Errorf("%w: -status: %w", cli.ErrUsage, err)
+			}
+			f.Statuses = append(f.Statuses, st)
+		}
+		for _, s := range cli.SplitList(*ids) {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return f, fmt.Errorf("%w: -id %q: %w", cli.ErrUsage, s, err)
+			}
+			f.MessageIDs = append(f.MessageIDs, id)
+		}
+		if f.Since, err = parseTime(*since); err != nil {
+			return f, fmt.Errorf("%w: -since: %w", cli.ErrUsage, err)
+		}
+		if f.Until, err = parseTime(*until); err != nil {
+			return f, fmt.Errorf("%w: -until: %w", cli.ErrUsage, err)
+		}
+		return f, nil
+	}
+}
+
+// parseTime accepts an RFC 3339 time or a duration meaning that long ago. The
+// empty string is the zero time, which Filter treats as unbounded.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	filter := filterFlags(fs)
+	limit := fs.Int("limit", 50, "maximum rows to print; 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	f.Limit = *limit
+
+	pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	msgs, err := outbox.List(ctx, pool, f)
+	if err != nil {
+		return err
+	}
+	printMessages(os.Stdout, msgs)
+	return nil
+}
+
+func printMessages(out io.Writer, msgs []outbox.Message) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE_ID\tSTATUS\tTYPE\tOCCURRED_AT\tATTEMPTS\tLAST_ERROR")
+	for _, m := range msgs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			m.MessageID, m.Status, m.PayloadType, m.OccurredAt.UTC().Format(time.RFC3339),
+			m.Attempts, cli.OneLine(m.LastError, 80))
+	}
+	_ = w.Flush()
+}
+
+func show(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: show takes exactly one MESSAGE_ID", cli.ErrUsage)
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", cli.ErrUsage, fs.Arg(0), err)
+	}
+
+	pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	m, err := outbox.Find(ctx, pool, id)
+	if err != nil {
+		return err
+	}
+	history, err := outbox.FailureHistory(ctx, pool, id)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "message_id\t%s\n", m.MessageID)
+	fmt.Fprintf(w, "row id\t%s\n", m.ID)
+	fmt.Fprintf(w, "status\t%s\n", m.Status)
+	fmt.Fprintf(w, "payload_type\t%s\n", m.PayloadType)
+	fmt.Fprintf(w, "occurred_at\t%s\n", m.OccurredAt.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "attempts\t%d\n", m.Attempts)
+	fmt.Fprintf(w, "next_attempt_at\t%s\n", m.NextAttemptAt.UTC().Format(time.RFC3339Nano))
+	if m.CompletedAt != nil {
+		fmt.Fprintf(w, "completed_at\t%s\n", m.CompletedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if m.LastError != "" {
+		fmt.Fprintf(w, "last_error\t%s\n", m.LastError)
+	}
+	if m.Traceparent != "" {
+		fmt.Fprintf(w, "traceparent\t%s\n", m.Traceparent)
+	}
+	if m.CorrelationID != "" {
+		fmt.Fprintf(w, "correlation_id\t%s\n", m.CorrelationID)
+	}
+	_ = w.Flush()
+
+	var payload json.RawMessage = m.Payload
+	pretty, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		pretty = m.Payload
+	}
+	fmt.Printf("\npayload:\n%s\n", pretty)
+
+	if len(history) == 0 {
+		return nil
+	}
+	fmt.Println("\nfailures:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FAILED_AT\tATTEMPT\tPROCESSOR\tERROR")
+	for _, f := range history {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+			f.FailedAt.UTC().Format(time.RFC3339), f.Attempt, f.Processor, cli.OneLine(f.Error, 120))
+	}
+	return w.Flush()
+}
+
+func requeue(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("requeue", flag.ContinueOnError)
+	filter := filterFlags(fs)
+	all := fs.Bool("all", false, "requeue every POISONED and EXCEEDED message; required when no filter is given")
+	dryRun := fs.Bool("dry-run", false, "report what would be requeued, and change nothing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	// A bare `requeue` resetting the whole table is one typo from an outage.
+	narrowed := len(f.Statuses) > 0 || len(f.MessageIDs) > 0 || f.PayloadType != "" ||
+		!f.Since.IsZero() || !f.Until.IsZero()
+	if !narrowed && !*all {
+		return fmt.Errorf("%w: requeue needs a filter, or -all to requeue every stalled message", cli.ErrUsage)
+	}
+
+	if len(f.Statuses) == 0 {
+		f.Statuses = []outbox.Status{outbox.Poisoned, outbox.Exceeded}
+	}
+
+	pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	if *dryRun {
+		msgs, err := outbox.List(ctx, pool, f)
+		if err != nil {
+			return err
+		}
+		printMessages(os.Stdout, msgs)
+	}
+
+	return inTx(ctx, pool, "requeued", *dryRun, func(ctx context.Context, q postgres.Querier) (int64, error) {
+		return outbox.Requeue(ctx, q, f)
+	})
+}
+
+func archive(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 0, "archive COMPLETED messages that completed longer ago than this, e.g. 720h")
+	batch := fs.Int("batch", 1000, "rows moved per statement")
+	dryRun := fs.Bool("dry-run", false, "report what would be archived, and change nothing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan <= 0 {
+		return fmt.Errorf("%w: archive needs -older-than", cli.ErrUsage)
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("%w: -batch must be positive", cli.ErrUsage)
+	}
+	cutoff := time.Now().Add(-*olderThan)
+
+	pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Create every month's partition first, back to the oldest row this run
+	// can move. Rows archived into the default partition would otherwise block
+	// creating their month's later.
+	if !*dryRun {
+		if err := outbox.EnsureArchivePartitions(ctx, pool, cutoff); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+	}
+
+	// Each batch commits on its own, so an archive of millions of rows never
+	// holds one enormous transaction open. A dry run cannot do that — its
+	// batches would never commit, and the next would select the same rows — so
+	// it moves everything in one transaction and rolls it back.
+	if *dryRun {
+		return inTx(ctx, pool, "archived", true, func(ctx context.Context, q postgres.Querier) (int64, error) {
+			var total int64
+			for {
+				n, err := outbox.ArchiveCompleted(ctx, q, cutoff, *batch)
+				total += n
+				if err != nil || n < int64(*batch) {
+					return total, err
+				}
+			}
+		})
+	}
+
+	var total int64
+	for {
+		n, err := outbox.ArchiveCompleted(ctx, pool, cutoff, *batch)
+		total += n
+		if err != nil {
+			return fmt.Errorf("after archiving %d message(s): %w", total, err)
+		}
+		if n < int64(*batch) {
+			break
+		}
+	}
+	fmt.Printf("archived %d message(s)\n", total)
+	return nil
+}
+
+// inTx runs fn in a transaction and reports how many messages it touched,
+// committing unless dryRun is set.
+func inTx(ctx context.Context, pool *pgxpool.Pool, verb string, dryRun bool,
+	fn func(context.Context, postgres.Querier) (int64, error)) error {
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	n, err := fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("dry run: %d message(s) would be %s; nothing was changed\n", n, verb)
+		return nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	fmt.Printf("%s %d message(s)\n", verb, n)
+	return nil
+}
@@ -1,21 +1,29 @@
 // Command relay drains the transactional outbox onto RabbitMQ.
 //
 // Run one or more replicas. FOR UPDATE SKIP LOCKED in the claim query means
-// replicas never contend over the same row.
+// replicas never contend over the same row, and a partition key is held by one
+// replica at a time, so its messages go out in the order they were enqueued.
 package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"eventify/events"
+	"eventify/outbox"
 	"eventify/outbox/processors"
 	"eventify/outbox/relay"
+	"eventify/outbox/retention"
 	platformamqp "eventify/platform/amqp"
 	"eventify/platform/config"
+	"eventify/platform/health"
 	"eventify/platform/logger"
+	"eventify/platform/metrics"
 	"eventify/platform/postgres"
 )
 
@@ -62,15 +70,88 @@ func main() {
 	// before it is safe to publish gets its own type embedding processors.Base.
 	procs := []processors.IOutboxProcessor{
 		processors.NewGeneric(pub, events.EventCreatedName),
+		processors.NewGeneric(pub, events.EventUpdatedName),
+		processors.NewGeneric(pub, events.EventDeletedName),
+		processors.NewGeneric(pub, events.UserSignedUpName),
+		processors.NewGeneric(pub, events.RoleAssignedName),
+		processors.NewGeneric(pub, events.PasswordChangedName),
 	}
 
-	// One relay instance, scaled vertically: raise OUTBOX_BATCH_SIZE before
-	// running a second replica.
+	opts := []relay.Option{
+		relay.WithBackoff(outbox.Backoff{
+			Base:   config.Duration("OUTBOX_RETRY_BASE", outbox.DefaultBackoff.Base),
+			Max:    config.Duration("OUTBOX_RETRY_MAX", outbox.DefaultBackoff.Max),
+			Jitter: outbox.DefaultBackoff.Jitter,
+		}),
+	}
+	// A batch is published on up to OUTBOX_WORKERS goroutines. Messages
+	// enqueued with the same partition key stay in order.
+	opts = append(opts, relay.WithConcurrency(
+		config.Int("OUTBOX_WORKERS", 8), relay.ByPartitionKey))
+	// A backlog is drained batch after batch on one tick, for at most
+	// OUTBOX_DRAIN_MAX_DURATION or OUTBOX_DRAIN_MAX_BATCHES batches (0: no
+	// limit). OUTBOX_DRAIN_MAX_BATCHES=1 restores one batch per tick.
+	opts = append(opts, relay.WithDrain(
+		config.Duration("OUTBOX_DRAIN_MAX_DURATION", relay.DefaultDrainDuration),
+		config.Int("OUTBOX_DRAIN_MAX_BATCHES", 0),
+	))
+	// New rows wake the relay through LISTEN/NOTIFY; polling slows to
+	// OUTBOX_LISTEN_POLL_INTERVAL while the listener is up and returns to
+	// OUTBOX_POLL_INTERVAL if it drops. 0 turns listening off.
+	if idle := config.Duration("OUTBOX_LISTEN_POLL_INTERVAL", relay.DefaultListenPollInterval); idle > 0 {
+		opts = append(opts, relay.WithListen(idle))
+	}
+
+	// Batch and publish timings are recorded as the relay works. The counts
+	// the outbox package doc says to alert on are read from the table at
+	// scrape time instead, so they are right whichever replica is scraped.
+	reg := metrics.NewRegistry()
+	opts = append(opts, relay.WithMetrics(reg))
+	registerOutboxStats(reg, pool, log)
+
+	// Replicas split the queue between them and keep each partition key in
+	// order, so adding one is a deployment change, not a configuration one.
 	r := relay.New(pool, procs, log,
 		config.Duration("OUTBOX_POLL_INTERVAL", relay.DefaultPollInterval),
 		config.Int("OUTBOX_BATCH_SIZE", relay.DefaultBatchSize),
+		opts...,
 	)
 
+	// Archiving runs beside the relay rather than as another binary: it needs
+	// the same pool and configuration, and it only touches COMPLETED rows, which
+	// the relay never claims. OUTBOX_RETENTION=0 turns it off.
+	if keep := config.Duration("OUTBOX_RETENTION", retention.DefaultRetention); keep > 0 {
+		w := retention.New(pool, log, keep,
+			config.Duration("OUTBOX_RETENTION_INTERVAL", retention.DefaultInterval),
+			config.Int("OUTBOX_RETENTION_BATCH_SIZE", retention.DefaultBatchSize),
+			config.Int("OUTBOX_RETENTION_MAX_PER_PASS", retention.DefaultMaxPerPass),
+		)
+		registerRetentionStats(reg, w)
+		go func() { _ = w.Run(ctx) }()
+		log.Info("outbox retention started")
+	}
+
+	// /healthz fails once no poll has succeeded for OUTBOX_MAX_POLL_AGE: the
+	// relay is wedged, and restarting it is the fix. /readyz fails too while
+	// Postgres or the broker is unreachable.
+	h := health.New()
+	h.Live("poll", health.Recent(r.LastPoll, config.Duration("OUTBOX_MAX_POLL_AGE", 2*time.Minute)))
+	h.Ready("postgres", health.Ping(pool))
+	h.Ready("amqp", health.Ping(pub))
+
+	// OUTBOX_HTTP_ADDR serves /metrics, /healthz and /readyz; empty turns it
+	// off.
+	if addr := config.String("OUTBOX_HTTP_ADDR", ":9090"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", reg.Handler())
+		h.Mount(mux)
+		go func() {
+			if err := metrics.Serve(ctx, addr, mux); err != nil {
+				log.ErrorWithError("http server stopped", err)
+			}
+		}()
+	}
+
 	log.Info("outbox relay started")
 	if err := r.Run(ctx); err != nil && ctx.Err() == nil {
 		log.ErrorWithError("relay stopped", err)
@@ -78,3 +159,63 @@ func main() {
 	}
 	log.Info("outbox relay stopped")
 }
+
+// registerOutboxStats exports outbox.ReadStats, refreshed on every scrape.
+func registerOutboxStats(reg *metrics.Registry, pool postgres.Querier, log *logger.Logger) {
+	messages := reg.Gauge("outbox_messages",
+		"Outbox rows that have not completed, by status.", "status")
+	oldest := reg.Gauge("outbox_oldest_queued_age_seconds",
+		"Time since the oldest QUEUED message occurred; 0 when none is queued.")
+
+	reg.OnScrape(func(ctx context.Context) {
+		s, err := outbox.ReadStats(ctx, pool)
+		if err != nil {
+			log.ErrorWithError("read outbox stats", err)
+			return
+		}
+		messages.Set(float64(s.Queued), outbox.Queued.String())
+		messages.Set(float64(s.Poisoned), outbox.Poisoned.String())
+		messages.Set(float64(s.Exceeded), outbox.Exceeded.String())
+		oldest.Set(s.OldestQueued.Seconds())
+	})
+}
+
+// registerRetentionStats exports the retention worker's Stats, refreshed on
+// every scrape. They are this replica's alone: every replica runs a worker, and
+// the totals across them are the sum.
+func registerRetentionStats(reg *metrics.Registry, w *retention.Worker) {
+	archived := reg.Counter("outbox_retention_archived_total",
+		"COMPLETED rows moved to outbox_messages_archive.")
+	passes := reg.Counter("outbox_retention_passes_total",
+		"Retention passes run.")
+	failed := reg.Counter("outbox_retention_failed_passes_total",
+		"Retention passes that stopped on an error.")
+	lastArchived := reg.Gauge("outbox_retention_last_pass_archived",
+		"Rows the most recent retention pass moved.")
+	lastAt := reg.Gauge("outbox_retention_last_pass_timestamp_seconds",
+		"When the most recent retention pass started, as a Unix time; 0 before the first.")
+	lastDuration := reg.Gauge("outbox_retention_last_pass_duration_seconds",
+		"How long the most recent retention pass took.")
+
+	// Counters only go up, so each scrape adds what the worker did since the
+	// one before. Two scrapes can run at once, hence the lock.
+	var (
+		mu   sync.Mutex
+		seen retention.Stats
+	)
+	reg.OnScrape(func(context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		s := w.Stats()
+		archived.Add(float64(s.Archived - seen.Archived))
+		passes.Add(float64(s.Passes - seen.Passes))
+		failed.Add(float64(s.FailedPasses - seen.FailedPasses))
+		seen = s
+
+		lastArchived.Set(float64(s.LastPassArchived))
+		if !s.LastPassAt.IsZero() {
+			lastAt.Set(float64(s.LastPassAt.Unix()))
+		}
+		lastDuration.Set(s.LastPassDuration.Seconds())
+	})
+}
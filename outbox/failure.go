@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eventify/platform/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// FailureHistoryLimit is how many failures are kept per message. Older ones are
+// pruned as new ones arrive, so an operator who resets a message over and over
+// does not grow its history without bound.
+const FailureHistoryLimit = 2 * MaxAttempts
+
+// maxErrorLen caps a stored error message. Anything longer is a payload or a
+// stack echoed into an error string, and the relay log already has it whole.
+const maxErrorLen = 4096
+
+// ErrNotFound is returned when no outbox row carries the requested message ID.
+var ErrNotFound = errors.New("outbox message not found")
+
+// Failure is why one attempt at a message did not succeed.
+//
+// Processor names what produced Err — see processors.Name. It is empty when no
+// processor was involved, as for a poisoned message.
+type Failure struct {
+	Err       error
+	Processor string
+}
+
+// FailureRecord is one entry in a message's failure history.
+type FailureRecord struct {
+	FailedAt  time.Time
+	Processor string
+	Error     string
+	Attempt   int32
+}
+
+// recordFailure stamps f onto m as its last error and appends it to the
+// message's history, pruning entries beyond FailureHistoryLimit. It does not
+// save m; the transition that called it does.
+func (m *Message) recordFailure(ctx context.Context, q postgres.Querier, f Failure) error {
+	now := time.Now().UTC()
+	msg := "unknown error"
+	if f.Err != nil {
+		msg = truncate(f.Err.Error(), maxErrorLen)
+	}
+	m.LastError = msg
+	m.LastErrorAt = &now
+
+	if _, err := q.Exec(ctx,
+		`INSERT INTO outbox_message_failures (outbox_id, attempt, processor, error, failed_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		m.ID, m.Attempts, f.Processor, msg, now); err != nil {
+		return fmt.Errorf("record failure for outbox message %s: %w", m.ID, err)
+	}
+
+	if _, err := q.Exec(ctx,
+		`DELETE FROM outbox_message_failures
+		  WHERE outbox_id = $1
+		    AND id NOT IN (SELECT id FROM outbox_message_failures
+		                    WHERE outbox_id = $1
+		                    ORDER BY id DESC
+		                    LIMIT $2)`,
+		m.ID, FailureHistoryLimit); err != nil {
+		return fmt.Errorf("prune failures for outbox message %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "") + "…"
+}
+
+// Find returns the outbox row carrying messageID — the same ID a consumer logs
+// and deduplicates on — or ErrNotFound.
+func Find(ctx context.Context, q postgres.Querier, messageID uuid.UUID) (Message, error) {
+	m, err := scanMessage(q.QueryRow(ctx,
+		`SELECT `+columns+` FROM outbox_messages WHERE message_id = $1`, messageID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Message{}, fmt.Errorf("%w: %s", ErrNotFound, messageID)
+	}
+	return m, err
+}
+
+// FailureHistory lists the recorded failures of the message carrying
+// messageID, oldest first. A message that never failed has an empty history.
+func FailureHistory(ctx context.Context, q postgres.Querier, messageID uuid.UUID) ([]FailureRecord, error) {
+	rows, err := q.Query(ctx,
+		`SELECT f.failed_at, f.processor, f.error, f.attempt
+		   FROM outbox_message_failures f
+		   JOIN outbox_messages m ON m.id = f.outbox_id
+		  WHERE m.message_id = $1
+		  ORDER BY f.id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("query failure history for %s: %w", messageID, err)
+	}
+	defer rows.Close()
+
+	var out []FailureRecord
+	for rows.Next() {
+		var r FailureRecord
+		if err := rows.Scan(&r.FailedAt, &r.Processor, &r.Error, &r.Attempt); err != nil {
+			return nil, fmt.Errorf("scan failure record: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
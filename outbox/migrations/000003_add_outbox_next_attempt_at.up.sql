@@ -0,0 +1,13 @@
+-- A failed message used to be re-queued for the very next poll, so attempts
+-- were spent at the poll rate and a broker outage of MaxAttempts poll intervals
+-- exceeded the whole backlog. next_attempt_at is when a QUEUED row next becomes
+-- claimable; the relay pushes it out exponentially on every failure.
+--
+-- Existing rows default to now(), so anything already queued stays claimable on
+-- the first poll after this migration.
+ALTER TABLE outbox_messages
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- The claim query still walks QUEUED rows in occurred_at order, so
+-- idx_outbox_messages_queued keeps serving it; next_attempt_at is a filter on
+-- that scan, not a new sort key.
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_outbox_message_failures_outbox_id;
+DROP TABLE IF EXISTS outbox_message_failures;
+
+ALTER TABLE outbox_messages
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS last_error_at;
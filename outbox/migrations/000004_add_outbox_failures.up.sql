@@ -0,0 +1,26 @@
+-- 000002 dropped last_error on the grounds that the relay logs every failure
+-- as it happens. That holds until a message goes EXCEEDED and on-call has to
+-- find out why: the log line lives on whichever relay replica handled the last
+-- attempt, if it has not rotated away. The row now carries its own account.
+--
+-- last_error is the most recent failure, for a glance at the row. The full
+-- account lives in outbox_message_failures, one row per failed attempt, bounded
+-- by the relay to outbox.FailureHistoryLimit entries per message.
+ALTER TABLE outbox_messages
+    ADD COLUMN IF NOT EXISTS last_error    TEXT,
+    ADD COLUMN IF NOT EXISTS last_error_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS outbox_message_failures (
+    id         BIGSERIAL PRIMARY KEY,
+    -- Cascades, so deleting an outbox row never leaves its history orphaned.
+    outbox_id  UUID        NOT NULL REFERENCES outbox_messages (id) ON DELETE CASCADE,
+    attempt    INT         NOT NULL,
+    -- Empty when no processor was involved, as for a poisoned message.
+    processor  TEXT        NOT NULL,
+    error      TEXT        NOT NULL,
+    failed_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- History is always read, and pruned, per message in insertion order.
+CREATE INDEX IF NOT EXISTS idx_outbox_message_failures_outbox_id
+    ON outbox_message_failures (outbox_id, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_outbox_messages_completed;
+DROP INDEX IF EXISTS idx_outbox_messages_archive_message_id;
+DROP TABLE IF EXISTS outbox_messages_archive_default;
+DROP TABLE IF EXISTS outbox_messages_archive;
@@ -0,0 +1,33 @@
+-- COMPLETED rows are never claimed again, but until now they were never
+-- removed either. outbox.ArchiveCompleted moves them here in bounded batches,
+-- keeping outbox_messages proportional to recent traffic while preserving what
+-- was published, and when, for audit.
+--
+-- Partitioned by completed_at so that dropping a month of history is a DROP
+-- TABLE on one partition rather than a DELETE over millions of rows. Rows land
+-- in the default partition until monthly partitions are created for them.
+CREATE TABLE IF NOT EXISTS outbox_messages_archive (
+    id           UUID        NOT NULL,
+    message_id   UUID        NOT NULL,
+    payload_type TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    occurred_at  TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL,
+    attempts     INT         NOT NULL,
+    archived_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- A partitioned table's primary key must include the partition key.
+    PRIMARY KEY (id, completed_at)
+) PARTITION BY RANGE (completed_at);
+
+CREATE TABLE IF NOT EXISTS outbox_messages_archive_default
+    PARTITION OF outbox_messages_archive DEFAULT;
+
+-- On-call looks archived messages up by the id a consumer logged.
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_archive_message_id
+    ON outbox_messages_archive (message_id);
+
+-- Archiving selects COMPLETED rows by age. Without this it would scan the whole
+-- table, QUEUED rows included, on every pass.
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_completed
+    ON outbox_messages (completed_at)
+    WHERE status = 3;
@@ -0,0 +1,25 @@
+-- The relay used to learn about new rows only by polling, so a message waited
+-- up to a full poll interval before it was published, and an idle relay still
+-- queried the table every interval. Every insert now NOTIFYs the relay, which
+-- LISTENs on a dedicated connection and claims the row at once.
+--
+-- A trigger rather than a NOTIFY in outbox.Enqueue: it covers every writer,
+-- including a hand-written INSERT during recovery. It is per statement, not per
+-- row, so a bulk insert wakes the relay once. NOTIFY is transactional — it is
+-- delivered on commit and dropped on rollback — so the relay is never woken for
+-- a row it cannot yet see. Identical notifications in one transaction collapse
+-- into one, so a handler that enqueues several events costs one wake-up.
+--
+-- The channel name is outbox.NotifyChannel.
+CREATE OR REPLACE FUNCTION notify_outbox_messages() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox_messages', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outbox_messages_notify ON outbox_messages;
+CREATE TRIGGER outbox_messages_notify
+    AFTER INSERT ON outbox_messages
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION notify_outbox_messages();
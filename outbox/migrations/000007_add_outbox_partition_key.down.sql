@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_outbox_messages_queued_partition;
+DROP INDEX IF EXISTS idx_outbox_messages_queued;
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_queued
+    ON outbox_messages (occurred_at)
+    WHERE status = 1;
+ALTER TABLE outbox_messages DROP COLUMN IF EXISTS seq;
+ALTER TABLE outbox_messages DROP COLUMN IF EXISTS partition_key;
+ALTER TABLE outbox_messages_archive DROP COLUMN IF EXISTS partition_key;
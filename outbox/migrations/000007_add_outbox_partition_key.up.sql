@@ -0,0 +1,34 @@
+-- Replicas claim with SKIP LOCKED, so two updates to the same event could be
+-- claimed by two replicas and published in either order. partition_key names
+-- what a message must stay in order with — usually the aggregate's ID — and
+-- outbox.FetchQueued never lets two transactions hold rows with the same key.
+-- Rows without one are not held to that, but every row, keyed or not, is now
+-- claimed in seq order rather than occurred_at order; see below.
+ALTER TABLE outbox_messages
+    ADD COLUMN IF NOT EXISTS partition_key TEXT;
+
+-- occurred_at cannot order one key's messages. It is the enqueueing
+-- transaction's start time, and two transactions updating the same row commit
+-- in the order they take its lock, not the order they began. seq is drawn when
+-- the row is inserted — after the business write has taken that lock — so it
+-- follows commit order for any one aggregate. Existing rows are numbered in no
+-- particular order; they carry no key, so nothing orders on them.
+ALTER TABLE outbox_messages
+    ADD COLUMN IF NOT EXISTS seq BIGINT GENERATED BY DEFAULT AS IDENTITY;
+
+-- The relay now claims in seq order. occurred_at stays the time the event
+-- happened, for operators and for List.
+DROP INDEX IF EXISTS idx_outbox_messages_queued;
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_queued
+    ON outbox_messages (seq)
+    WHERE status = 1;
+
+-- Serves the check for an earlier QUEUED row of the same key.
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_queued_partition
+    ON outbox_messages (partition_key, seq)
+    WHERE status = 1 AND partition_key IS NOT NULL;
+
+-- An archived row keeps its key, so on-call can still see which messages were
+-- held in order with which.
+ALTER TABLE outbox_messages_archive
+    ADD COLUMN IF NOT EXISTS partition_key TEXT;
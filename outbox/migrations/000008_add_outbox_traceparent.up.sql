@@ -0,0 +1,15 @@
+-- The W3C traceparent of the span that enqueued the message, if there was one.
+--
+-- A trace used to end at the API: the request that created an event had a
+-- span, and nothing after the commit knew about it. The row is the only thing
+-- that crosses from the request's transaction to the relay, so it carries the
+-- trace across; the relay sends it on as an AMQP header, and the subscriber's
+-- span continues the same trace.
+--
+-- Nullable: rows enqueued outside a traced request, and every row written
+-- before this migration, have none.
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS traceparent TEXT;
+
+-- An archived row keeps it, so a trace can still be followed from a message
+-- that has left outbox_messages.
+ALTER TABLE outbox_messages_archive ADD COLUMN IF NOT EXISTS traceparent TEXT;
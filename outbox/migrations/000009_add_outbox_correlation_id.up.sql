@@ -0,0 +1,15 @@
+-- The correlation ID of the chain of messages this one belongs to, if it was
+-- enqueued while handling another message.
+--
+-- A subscriber handler that enqueues a follow-up passes the correlation ID of
+-- the message it is handling on to the follow-up, so everything one request
+-- set off can be found by one ID. The relay sends it in the message's
+-- envelope.
+--
+-- Nullable: a message that starts a chain has none stored, and the relay
+-- sends its own message ID instead.
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS correlation_id TEXT;
+
+-- An archived row keeps it, so a chain can still be traced through messages
+-- that have left outbox_messages.
+ALTER TABLE outbox_messages_archive ADD COLUMN IF NOT EXISTS correlation_id TEXT;
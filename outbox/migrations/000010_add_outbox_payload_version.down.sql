@@ -0,0 +1,2 @@
+ALTER TABLE outbox_messages DROP COLUMN IF EXISTS payload_version;
+ALTER TABLE outbox_messages_archive DROP COLUMN IF EXISTS payload_version;
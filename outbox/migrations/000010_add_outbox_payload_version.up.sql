@@ -0,0 +1,13 @@
+-- The contract version the payload was encoded against; see events.Version.
+--
+-- A row can outlive the version it was written at: it can sit queued across a
+-- deploy, or be requeued from EXCEEDED long after. The relay sends the stored
+-- version in the message's envelope, so a consumer upcasts the payload rather
+-- than decoding it as a shape it no longer has.
+--
+-- Nullable: every row written before this migration is version 1, the only
+-- version there was, and is read as such.
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS payload_version INT;
+
+-- An archived row keeps it, so its payload can still be upcast to be read.
+ALTER TABLE outbox_messages_archive ADD COLUMN IF NOT EXISTS payload_version INT;
@@ -21,46 +21,113 @@
 // A message leaves the queue for good in two ways, and both are meant to be
 // noticed rather than absorbed:
 //
-//   - EXCEEDED: it failed MaxAttempts times. Attempts are spent one per poll,
-//     so a broker outage lasting MaxAttempts poll intervals will exceed the
-//     backlog rather than wait it out. This is deliberate — the outbox stopping
-//     is a thing to alert on, not to silently retry forever.
+//   - EXCEEDED: it failed MaxAttempts times. Retries are spaced by an
+//     exponential Backoff, so with the defaults a message survives roughly
+//     eight minutes of continuous failure before it stops. An outage longer
+//     than that exceeds the backlog rather than waiting it out. This is
+//     deliberate — the outbox stopping is a thing to alert on, not to silently
+//     retry forever.
 //   - POISONED: no processor claims its payload type. The relay binary does not
 //     know the event, usually because a producer shipped ahead of the relay.
 //
 // Both are cleared the same way, once the cause is fixed. Alert on either count
-// being non-zero, then:
+// being non-zero — the relay exports both on /metrics, as outbox_messages by
+// status — then requeue them with cmd/outboxctl, which can narrow the reset by
+// payload type, time range or message ID and dry-run it first:
+//
+//	outboxctl requeue -status POISONED,EXCEEDED -dry-run
+//
+// Without the tool, the same reset by hand is:
 //
 //	UPDATE outbox_messages
 //	   SET status = 1, attempts = 0
 //	 WHERE status IN (2, 4);   -- POISONED, EXCEEDED
 //
-// Messages resume in occurred_at order, and consumers deduplicate on MessageID,
-// so replaying one that did in fact publish is safe.
+// Messages resume in the order they were enqueued, and consumers deduplicate
+// on MessageID, so replaying one that did in fact publish is safe.
+//
+// To see why a message stopped before resetting it, read its last_error, or
+// its full FailureHistory: every failed attempt is recorded with the processor
+// that raised it, in the same transaction as the status change.
 package outbox
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"strconv"
 	"time"
 
+	"eventify/events"
 	"eventify/platform/postgres"
+	"eventify/platform/telemetry"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 // MaxAttempts is how many times the relay will retry a message before giving up
 // on it. An exceeded message stays in the table for inspection; it is never
 // claimed again until an operator resets it — see the package doc.
 //
-// Attempts are consumed once per poll, with no delay between them, so a failure
-// that persists for MaxAttempts poll intervals exceeds the message. Size the
-// relay's poll interval against how long you are willing to let a broker outage
-// run before it needs a hand.
+// How long that takes is set by the Backoff the relay retries with, not by its
+// poll interval: a failed message is not claimed again until its
+// next_attempt_at has passed.
 const MaxAttempts = 10
 
+// NotifyChannel is the channel every insert into outbox_messages NOTIFYs, from
+// a trigger, once the inserting transaction commits. A relay LISTENing on it
+// claims new rows at once instead of at its next poll.
+const NotifyChannel = "outbox_messages"
+
+// Backoff spaces out the retries of a failing message.
+//
+// The delay doubles with every failed attempt, starting at Base and capped at
+// Max. Jitter shaves a random fraction, up to Jitter itself, off each delay, so
+// a backlog that failed together during an outage does not retry together the
+// moment the broker comes back.
+//
+// The zero Backoff retries on the very next poll, which is how the relay
+// behaved before next_attempt_at existed.
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// DefaultBackoff waits 1s, 2s, 4s … up to 5m between attempts. Across
+// MaxAttempts that is about eight and a half minutes, long enough to ride out a
+// RabbitMQ restart without an operator resetting rows by hand.
+var DefaultBackoff = Backoff{Base: time.Second, Max: 5 * time.Minute, Jitter: 0.2}
+
+// Delay is how long to wait after the given number of failed attempts. A
+// non-positive Max leaves the delay uncapped.
+func (b Backoff) Delay(attempts int32) time.Duration {
+	if b.Base <= 0 || attempts <= 0 {
+		return 0
+	}
+	limit := b.Max
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	d := b.Base
+	for i := int32(1); i < attempts && d < limit; i++ {
+		// Doubling past limit/2 would either exceed the cap or overflow.
+		if d > limit/2 {
+			d = limit
+			break
+		}
+		d *= 2
+	}
+	d = min(d, limit)
+	if b.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(b.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
 // Status is where a message sits in its lifecycle.
 //
 // The numeric values are persisted in outbox_messages.status. Append new
@@ -102,15 +169,33 @@ func (s Status) String() string {
 // row is written by one binary and read by another, possibly after a refactor
 // renamed the struct or moved its package. A reflected name would stop matching
 // and the backlog would be poisoned.
+//
+// LastError and LastErrorAt describe the most recent failed attempt, or why the
+// message was poisoned. Earlier failures are kept in FailureHistory.
 type Message struct {
-	OccurredAt  time.Time
-	CompletedAt *time.Time
-	Payload     []byte
-	PayloadType string
-	ID          uuid.UUID
-	MessageID   uuid.UUID
-	Attempts    int32
-	Status      Status
+	OccurredAt    time.Time
+	NextAttemptAt time.Time
+	CompletedAt   *time.Time
+	LastErrorAt   *time.Time
+	Payload       []byte
+	PayloadType   string
+	// PayloadVersion is the version of PayloadType's contract Payload was
+	// encoded against.
+	PayloadVersion int
+	LastError      string
+	// PartitionKey is what the message must stay in order with, or empty if
+	// nothing; see WithPartitionKey.
+	PartitionKey string
+	// Traceparent is the W3C traceparent of the span the message was
+	// enqueued under, or empty if there was none.
+	Traceparent string
+	// CorrelationID is the chain the message was enqueued in, or empty if it
+	// starts one; see Enqueue.
+	CorrelationID string
+	ID            uuid.UUID
+	MessageID     uuid.UUID
+	Attempts      int32
+	Status        Status
 }
 
 // Each transition writes itself through q, which must be the transaction that
@@ -133,19 +218,34 @@ func (m *Message) Complete(ctx context.Context, q postgres.Querier) error {
 // may be transient — the broker was down, the network blipped. An unclaimed
 // message will be unclaimed on every subsequent poll too, so retrying it only
 // burns attempts and delays the messages behind it.
+//
+// The reason is recorded as a failure with no processor, so an operator reading
+// the row sees why it stopped without finding the relay log that says so.
 func (m *Message) Poison(ctx context.Context, q postgres.Querier) error {
 	m.Status = Poisoned
+	f := Failure{Err: fmt.Errorf("no processor registered for payload type %q", m.PayloadType)}
+	if err := m.recordFailure(ctx, q, f); err != nil {
+		return err
+	}
 	return m.save(ctx, q)
 }
 
 // FailOrRequeue records a failed attempt, re-queueing the message unless it has
-// run out of retries.
-func (m *Message) FailOrRequeue(ctx context.Context, q postgres.Querier) error {
+// run out of retries. A re-queued message is not claimed again until b's delay
+// for its attempt count has passed.
+//
+// f is kept on the row as LastError and appended to the message's failure
+// history, in the same transaction as the status change.
+func (m *Message) FailOrRequeue(ctx context.Context, q postgres.Querier, f Failure, b Backoff) error {
 	m.Attempts++
 	if m.Attempts >= MaxAttempts {
 		m.Status = Exceeded
 	} else {
 		m.Status = Queued
+		m.NextAttemptAt = time.Now().UTC().Add(b.Delay(m.Attempts))
+	}
+	if err := m.recordFailure(ctx, q, f); err != nil {
+		return err
 	}
 	return m.save(ctx, q)
 }
@@ -155,15 +255,34 @@ func (m *Message) FailOrRequeue(ctx context.Context, q postgres.Querier) error {
 func (m *Message) save(ctx context.Context, q postgres.Querier) error {
 	_, err := q.Exec(ctx,
 		`UPDATE outbox_messages
-		    SET status = $1, attempts = $2, completed_at = $3
-		  WHERE id = $4`,
-		m.Status, m.Attempts, m.CompletedAt, m.ID)
+		    SET status = $1, attempts = $2, completed_at = $3, next_attempt_at = $4,
+		        last_error = NULLIF($5, ''), last_error_at = $6
+		  WHERE id = $7`,
+		m.Status, m.Attempts, m.CompletedAt, m.NextAttemptAt,
+		m.LastError, m.LastErrorAt, m.ID)
 	if err != nil {
 		return fmt.Errorf("save outbox message %s: %w", m.ID, err)
 	}
 	return nil
 }
 
+// EnqueueOption adjusts one Enqueue.
+type EnqueueOption func(*enqueueOptions)
+
+type enqueueOptions struct {
+	partitionKey string
+}
+
+// WithPartitionKey orders the message after every message enqueued earlier
+// with the same key, usually the ID of the aggregate it is about. Messages
+// sharing a key are never claimed by two relay replicas at once, and are
+// published in the order their transactions inserted them.
+//
+// A message without a key has no such guarantee. An empty key is no key.
+func WithPartitionKey(key string) EnqueueOption {
+	return func(o *enqueueOptions) { o.partitionKey = key }
+}
+
 // Enqueue records an event for publication inside the caller's transaction.
 //
 // q must be the same pgx.Tx that performed the business write. Passing a pool
@@ -174,16 +293,34 @@ func (m *Message) save(ctx context.Context, q postgres.Querier) error {
 // caller has already stamped it into the payload as the consumer's
 // deduplication key. Minting a second one would leave the row and its payload
 // disagreeing about the identity of the same message.
-func Enqueue(ctx context.Context, q postgres.Querier, payloadType string, messageID uuid.UUID, payload any) error {
+//
+// The span in ctx, if any, is stored as the row's traceparent, so the trace
+// that produced the event continues into its consumers. So is ctx's
+// events.CorrelationID, which a subscriber sets while handling a message, so
+// that a follow-up joins the chain of the message that caused it.
+//
+// The row records the version of payloadType's contract this binary encodes,
+// so that a consumer can upcast the payload once the contract has moved on.
+func Enqueue(ctx context.Context, q postgres.Querier, payloadType string, messageID uuid.UUID, payload any,
+	opts ...EnqueueOption) error {
+
+	var o enqueueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal %s payload: %w", payloadType, err)
 	}
 
 	_, err = q.Exec(ctx,
-		`INSERT INTO outbox_messages (id, message_id, payload_type, payload, occurred_at, status)
-		 VALUES ($1, $2, $3, $4, now(), $5)`,
-		uuid.New(), messageID, payloadType, body, Queued,
+		`INSERT INTO outbox_messages
+		     (id, message_id, payload_type, payload, occurred_at, status, partition_key, traceparent,
+		      correlation_id, payload_version)
+		 VALUES ($1, $2, $3, $4, now(), $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0))`,
+		uuid.New(), messageID, payloadType, body, Queued, o.partitionKey, telemetry.Traceparent(ctx),
+		events.CorrelationID(ctx), events.Version(payloadType),
 	)
 	if err != nil {
 		return fmt.Errorf("enqueue %s: %w", payloadType, err)
@@ -191,33 +328,173 @@ func Enqueue(ctx context.Context, q postgres.Querier, payloadType string, messag
 	return nil
 }
 
-// FetchQueued claims up to limit queued rows for this relay instance.
+// FetchQueued claims up to limit queued rows for this relay instance, in the
+// order they were enqueued. It may return fewer than limit while more are
+// queued: see the partition rules below.
+//
+// Only rows whose next_attempt_at has arrived are eligible. A message backing
+// off after a failure is skipped, and unkeyed rows queued behind it go ahead.
 //
 // FOR UPDATE SKIP LOCKED lets several relay replicas poll the same table
 // concurrently without handing the same row to two of them, and without
 // blocking each other. Rows stay claimed until the surrounding transaction
 // ends, so a crashed relay releases its claim automatically.
+//
+// SKIP LOCKED alone would still let two replicas claim two rows with the same
+// partition key and publish them in either order, so keyed rows are held to
+// two more rules. q must be a transaction for them to mean anything:
+//
+//   - Each key is claimed under a transaction-scoped advisory lock. A key
+//     another transaction holds is skipped whole, and comes back once that
+//     transaction ends.
+//   - A row is returned only if no earlier QUEUED row with its key is left
+//     unclaimed — one backing off, say, or one that LIMIT cut. The check runs
+//     after the lock is taken, so it sees what the key's previous holder
+//     committed. A row that leaves the queue for good, EXCEEDED or POISONED,
+//     no longer holds back the rows behind it.
+//
+// Rows dropped by either rule stay locked until the transaction ends. Nobody
+// else could have taken them anyway.
 func FetchQueued(ctx context.Context, q postgres.Querier, limit int) ([]Message, error) {
+	msgs, _, err := ClaimQueued(ctx, q, limit)
+	return msgs, err
+}
+
+// ClaimQueued is FetchQueued, also returning how many rows the claim selected
+// before the partition rules dropped any. A short result with a full selection
+// is not an empty queue: the rows it lost are held by another transaction or
+// queued behind an earlier row of their key, and the rows after them are
+// still waiting.
+func ClaimQueued(ctx context.Context, q postgres.Querier, limit int) ([]Message, int, error) {
 	rows, err := q.Query(ctx,
-		`SELECT id, message_id, payload_type, payload, occurred_at, attempts, status
+		`SELECT `+columns+`
 		   FROM outbox_messages
 		  WHERE status = $1
-		  ORDER BY occurred_at
+		    AND next_attempt_at <= now()
+		  ORDER BY seq
 		  LIMIT $2
 		    FOR UPDATE SKIP LOCKED`, Queued, limit)
 	if err != nil {
-		return nil, fmt.Errorf("fetch queued: %w", err)
+		return nil, 0, fmt.Errorf("fetch queued: %w", err)
 	}
 	defer rows.Close()
 
 	var out []Message
 	for rows.Next() {
-		var m Message
-		if err := rows.Scan(&m.ID, &m.MessageID, &m.PayloadType, &m.Payload,
-			&m.OccurredAt, &m.Attempts, &m.Status); err != nil {
-			return nil, fmt.Errorf("scan outbox row: %w", err)
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, 0, err
 		}
 		out = append(out, m)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	selected := len(out)
+	out, err = holdPartitions(ctx, q, out)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, selected, nil
+}
+
+// holdPartitions applies FetchQueued's partition rules to a claimed batch and
+// returns the rows that survive them, in their original order.
+func holdPartitions(ctx context.Context, q postgres.Querier, msgs []Message) ([]Message, error) {
+	var keys []string
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		if m.PartitionKey != "" && !seen[m.PartitionKey] {
+			seen[m.PartitionKey] = true
+			keys = append(keys, m.PartitionKey)
+		}
+	}
+	if len(keys) == 0 {
+		return msgs, nil
+	}
+
+	// The lock is on a hash of the key. A collision makes two keys wait on
+	// each other, which costs throughput and never ordering.
+	held := map[string]bool{}
+	rows, err := q.Query(ctx,
+		`SELECT k FROM unnest($1::text[]) AS k
+		  WHERE pg_try_advisory_xact_lock(hashtextextended('outbox_messages:' || k, 0))`, keys)
+	if err != nil {
+		return nil, fmt.Errorf("lock outbox partitions: %w", err)
+	}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan outbox partition: %w", err)
+		}
+		held[k] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("lock outbox partitions: %w", err)
+	}
+
+	var ids []uuid.UUID
+	for _, m := range msgs {
+		if held[m.PartitionKey] {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	blocked := map[uuid.UUID]bool{}
+	if len(ids) > 0 {
+		rows, err := q.Query(ctx,
+			`SELECT c.id
+			   FROM outbox_messages c
+			  WHERE c.id = ANY($1::uuid[])
+			    AND EXISTS (SELECT 1
+			                  FROM outbox_messages o
+			                 WHERE o.partition_key = c.partition_key
+			                   AND o.status = $2
+			                   AND o.seq < c.seq
+			                   AND NOT (o.id = ANY($1::uuid[])))`, ids, Queued)
+		if err != nil {
+			return nil, fmt.Errorf("check outbox partition order: %w", err)
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan blocked outbox row: %w", err)
+			}
+			blocked[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("check outbox partition order: %w", err)
+		}
+	}
+
+	out := msgs[:0]
+	for _, m := range msgs {
+		if m.PartitionKey == "" || (held[m.PartitionKey] && !blocked[m.ID]) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// columns is the projection every read of outbox_messages uses, in scanMessage
+// order.
+const columns = `id, message_id, payload_type, payload, occurred_at, next_attempt_at,
+	attempts, status, completed_at, COALESCE(last_error, ''), last_error_at,
+	COALESCE(partition_key, ''), COALESCE(traceparent, ''), COALESCE(correlation_id, ''),
+	COALESCE(payload_version, 1)`
+
+// scanMessage reads one row in columns order.
+func scanMessage(row pgx.Row) (Message, error) {
+	var m Message
+	if err := row.Scan(&m.ID, &m.MessageID, &m.PayloadType, &m.Payload,
+		&m.OccurredAt, &m.NextAttemptAt, &m.Attempts, &m.Status,
+		&m.CompletedAt, &m.LastError, &m.LastErrorAt, &m.PartitionKey, &m.Traceparent,
+		&m.CorrelationID, &m.PayloadVersion); err != nil {
+		return Message{}, fmt.Errorf("scan outbox row: %w", err)
+	}
+	return m, nil
 }
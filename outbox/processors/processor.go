@@ -20,6 +20,7 @@ import (
 
 	"eventify/events"
 	"eventify/outbox"
+	platformamqp "eventify/platform/amqp"
 
 	"github.com/google/uuid"
 )
@@ -30,6 +31,23 @@ type Publisher interface {
 	Publish(ctx context.Context, routingKey, messageID string, body []byte) error
 }
 
+// Outgoing is one message handed to a BatchPublisher. It is the amqp
+// package's type, so that Publisher satisfies BatchPublisher as it stands.
+type Outgoing = platformamqp.Outgoing
+
+// BatchPublisher is a Publisher that can also send several messages for about
+// the price of one round trip. PublishBatch returns one result per message, at
+// the same index.
+//
+// The relay uses it for a batch in which every message is handled by a
+// Generic sharing one BatchPublisher. Only Generic qualifies: it is the one
+// processor known to do nothing but publish the stored bytes, so the relay can
+// publish for it.
+type BatchPublisher interface {
+	Publisher
+	PublishBatch(ctx context.Context, msgs []Outgoing) []error
+}
+
 // IOutboxProcessor handles one payload type.
 //
 // CanProcess must be cheap and side-effect free: the relay calls it on every
@@ -39,16 +57,55 @@ type IOutboxProcessor interface {
 	ProcessAsync(ctx context.Context, m *outbox.Message) error
 }
 
-// publish sends a message's stored bytes under its payload type's routing key.
+// Name identifies p in a message's failure history: its String method when it
+// has one, otherwise its Go type. It is a label for an operator, never a
+// dispatch key — dispatch is CanProcess's job.
+func Name(p IOutboxProcessor) string {
+	if s, ok := p.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+// publish sends a message's stored bytes under its payload type's routing key,
+// with its envelope as headers.
 //
 // The bytes go out exactly as they were enqueued, rather than being re-encoded
 // from a struct. Round-tripping through the current binary's view of the
 // contract would silently drop any field it does not know about, which is the
 // one thing an additive-only contract is supposed to survive.
 func publish(ctx context.Context, pub Publisher, m *outbox.Message) error {
+	ctx = platformamqp.WithHeaders(ctx, Envelope(m).Headers())
 	return pub.Publish(ctx, events.RoutingKey(m.PayloadType), m.MessageID.String(), m.Payload)
 }
 
+// Producer names the relay as the producer in the envelopes it sends.
+const Producer = "eventify-outbox-relay"
+
+// Envelope is the envelope m is published with. Its version is the one the
+// row was enqueued at, which may be older than the relay's own: the consumer
+// upcasts it. A message built by hand, with no version, gets the relay's. A
+// message that starts a chain is its own correlation ID.
+func Envelope(m *outbox.Message) events.Envelope {
+	correlationID := m.CorrelationID
+	if correlationID == "" {
+		correlationID = m.MessageID.String()
+	}
+	version := m.PayloadVersion
+	if version == 0 {
+		version = events.Version(m.PayloadType)
+	}
+	return events.Envelope{
+		Name:          m.PayloadType,
+		Version:       version,
+		MessageID:     m.MessageID,
+		OccurredAt:    m.OccurredAt,
+		Producer:      Producer,
+		Traceparent:   m.Traceparent,
+		CorrelationID: correlationID,
+	}
+}
+
 // Generic publishes an event's payload unchanged.
 //
 // It does not decode the payload, and so cannot reject a malformed one. That is
@@ -68,11 +125,30 @@ func NewGeneric(pub Publisher, payloadType string) *Generic {
 // CanProcess reports whether m carries the payload type this processor handles.
 func (g *Generic) CanProcess(m *outbox.Message) bool { return m.PayloadType == g.payloadType }
 
+// String names the processor by the payload type it publishes. Every Generic
+// shares one Go type, so the type alone would not say which one failed.
+func (g *Generic) String() string { return "Generic(" + g.payloadType + ")" }
+
 // ProcessAsync publishes the payload as stored.
 func (g *Generic) ProcessAsync(ctx context.Context, m *outbox.Message) error {
 	return publish(ctx, g.pub, m)
 }
 
+// Publisher is the bus this processor writes to.
+func (g *Generic) Publisher() Publisher { return g.pub }
+
+// Outgoing is exactly what ProcessAsync would publish for m, for a caller
+// publishing it in a batch instead.
+func (g *Generic) Outgoing(m *outbox.Message) Outgoing {
+	return Outgoing{
+		RoutingKey:  events.RoutingKey(m.PayloadType),
+		MessageID:   m.MessageID.String(),
+		Body:        m.Payload,
+		Traceparent: m.Traceparent,
+		Headers:     Envelope(m).Headers(),
+	}
+}
+
 // Base is the extension point for an event that needs work done before it is
 // published. Embed it, and call Process from ProcessAsync.
 //
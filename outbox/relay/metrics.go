@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"time"
+
+	"eventify/platform/metrics"
+)
+
+// relayMetrics are the series a relay records as it works. The outbox's
+// standing — counts by status, the oldest queued message — is not among them:
+// it is read from the table at scrape time, so every replica reports the same
+// numbers and a relay that is down still reports them through another.
+type relayMetrics struct {
+	batchDuration   *metrics.Histogram
+	publishDuration *metrics.Histogram
+	publishFailures *metrics.Counter
+}
+
+// WithMetrics registers the relay's metrics in reg and records them: how long
+// each non-empty batch took from claim to commit, and how long each publish
+// took and how many failed, by payload type.
+func WithMetrics(reg *metrics.Registry) Option {
+	m := &relayMetrics{
+		batchDuration: reg.Histogram("outbox_batch_duration_seconds",
+			"Time to claim, publish and record one non-empty batch.", nil),
+		publishDuration: reg.Histogram("outbox_publish_duration_seconds",
+			"Time to publish one message and have the broker confirm it.", nil, "payload_type"),
+		publishFailures: reg.Counter("outbox_publish_failures_total",
+			"Publishes that failed, and were left to retry or exceeded.", "payload_type"),
+	}
+	return func(r *Relay) { r.metrics = m }
+}
+
+// observeBatch records a batch that started at start. A relay without
+// WithMetrics records nothing.
+func (m *relayMetrics) observeBatch(start time.Time) {
+	if m != nil {
+		m.batchDuration.Since(start)
+	}
+}
+
+// observePublish records one publish of a payloadType message that started
+// at start and ended in err.
+func (m *relayMetrics) observePublish(payloadType string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.publishDuration.Since(start, payloadType)
+	if err != nil {
+		m.publishFailures.Inc(payloadType)
+	}
+}
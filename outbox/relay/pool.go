@@ -0,0 +1,224 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"eventify/outbox"
+	"eventify/outbox/processors"
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/telemetry"
+)
+
+// PartitionFunc names the ordering partition a message belongs to. Messages
+// with the same key are published one after another, in the order they were
+// claimed; messages with different keys may be published concurrently.
+//
+// The key is usually the aggregate the event is about, so that two updates to
+// one event are never in flight at once. An empty key is a partition like any
+// other: every message without a key is published in order with the rest.
+type PartitionFunc func(m *outbox.Message) string
+
+// ByPartitionKey keys a message by the partition key it was enqueued with —
+// see outbox.WithPartitionKey — which is what FetchQueued orders claims by, so
+// the order a batch is published in agrees with the order rows were claimed
+// in. A message enqueued without a key promised no order, and gets a partition
+// of its own.
+func ByPartitionKey(m *outbox.Message) string {
+	if m.PartitionKey == "" {
+		return "message:" + m.MessageID.String()
+	}
+	return "key:" + m.PartitionKey
+}
+
+// WithConcurrency publishes the messages of one batch on up to workers
+// goroutines, keeping messages with the same partition key in claim order. A
+// nil key puts every message in one partition, which is serial whatever the
+// worker count. A batch that can be published through a BatchPublisher does
+// not need the workers: it is pipelined on one connection instead.
+//
+// Outcomes are still recorded in the claiming transaction, once every publish
+// in the batch has returned. A transaction is one connection and cannot be
+// written from several goroutines, and recording after the fact costs nothing:
+// until the commit, no outcome is visible anyway.
+func WithConcurrency(workers int, key PartitionFunc) Option {
+	return func(r *Relay) {
+		r.workers = max(workers, 1)
+		r.partition = key
+	}
+}
+
+// attempt is what publishing one claimed message came to.
+type attempt struct {
+	proc processors.IOutboxProcessor
+	err  error
+	// tried is false for a message that was never handed to its processor,
+	// because another message failed first.
+	tried bool
+}
+
+// publishAll hands each message with a processor in attempts to that processor,
+// partition by partition, and fills in how each went. Messages with no
+// processor are skipped; the caller poisons them.
+//
+// The first failure stops the batch as it would a serial one: messages after it
+// in its partition must not overtake it, and a worker in any other partition
+// starts nothing new, because the failure is most often the broker being
+// unreachable. Publishes already in flight run to completion — they may well
+// have gone out, and their outcome has to be recorded either way.
+//
+// An unroutable message is the exception. The broker answered, so it is up;
+// only that message's routing key has no queue bound. Its partition stops, and
+// the rest of the batch carries on.
+//
+// When every message goes to a Generic sharing one BatchPublisher, the batch is
+// published through it instead — see publishBatched — under the same rules.
+func (r *Relay) publishAll(ctx context.Context, msgs []outbox.Message, attempts []attempt) {
+	parts := r.partitions(msgs, attempts)
+	if bp := batchPublisher(attempts); bp != nil {
+		r.publishBatched(ctx, bp, msgs, attempts, parts)
+		return
+	}
+
+	queue := make(chan []int, len(parts))
+	for _, idx := range parts {
+		queue <- idx
+	}
+	close(queue)
+
+	var (
+		stop atomic.Bool
+		wg   sync.WaitGroup
+	)
+	for range min(r.workers, len(parts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				for _, i := range idx {
+					if stop.Load() {
+						break
+					}
+					a := &attempts[i]
+					a.tried = true
+					// The stored traceparent rides ctx into the processor,
+					// and from there into the published message's headers.
+					pctx := telemetry.WithTraceparent(ctx, msgs[i].Traceparent)
+					start := time.Now()
+					a.err = a.proc.ProcessAsync(pctx, &msgs[i])
+					r.metrics.observePublish(msgs[i].PayloadType, start, a.err)
+					if a.err != nil {
+						if stopsBatch(a.err) {
+							stop.Store(true)
+						}
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// partitions groups the indexes of the messages that have a processor by
+// partition key, each group in claim order, the groups in order of first
+// appearance.
+func (r *Relay) partitions(msgs []outbox.Message, attempts []attempt) [][]int {
+	var (
+		order   []string
+		members = map[string][]int{}
+	)
+	for i := range msgs {
+		if attempts[i].proc == nil {
+			continue
+		}
+		key := ""
+		if r.partition != nil {
+			key = r.partition(&msgs[i])
+		}
+		if _, seen := members[key]; !seen {
+			order = append(order, key)
+		}
+		members[key] = append(members[key], i)
+	}
+
+	out := make([][]int, len(order))
+	for i, key := range order {
+		out[i] = members[key]
+	}
+	return out
+}
+
+// stopsBatch reports whether a failure should stop the rest of the batch, or
+// only the failed message's partition.
+func stopsBatch(err error) bool {
+	return !errors.Is(err, platformamqp.ErrUnroutable)
+}
+
+// batchPublisher returns the BatchPublisher every processor in attempts
+// publishes through, or nil unless they are all Generics sharing one.
+func batchPublisher(attempts []attempt) processors.BatchPublisher {
+	var bp processors.BatchPublisher
+	for _, a := range attempts {
+		if a.proc == nil {
+			continue
+		}
+		g, ok := a.proc.(*processors.Generic)
+		if !ok {
+			return nil
+		}
+		pub, ok := g.Publisher().(processors.BatchPublisher)
+		if !ok || (bp != nil && pub != bp) {
+			return nil
+		}
+		bp = pub
+	}
+	return bp
+}
+
+// publishBatched publishes through bp in waves. Each wave takes the next
+// message of every partition that is still going and publishes them all in one
+// PublishBatch; a partition stops at its first failure, and a failure that
+// stops the batch ends it after the wave it happened in.
+//
+// A wave never holds two messages of one partition. Their confirms come back
+// together, so by the time the second's failure was known the first could be
+// out — or, failing first, be overtaken by the second. When keys are mostly
+// distinct, as aggregate IDs are, one wave is the whole batch.
+func (r *Relay) publishBatched(ctx context.Context, bp processors.BatchPublisher,
+	msgs []outbox.Message, attempts []attempt, parts [][]int) {
+
+	for len(parts) > 0 {
+		wave := make([]processors.Outgoing, len(parts))
+		for p, idx := range parts {
+			i := idx[0]
+			wave[p] = attempts[i].proc.(*processors.Generic).Outgoing(&msgs[i])
+		}
+
+		// A wave's messages are confirmed together, so each is recorded as
+		// taking as long as the wave did.
+		start := time.Now()
+		results := bp.PublishBatch(ctx, wave)
+
+		stop := false
+		next := parts[:0]
+		for p, idx := range parts {
+			a := &attempts[idx[0]]
+			a.tried, a.err = true, results[p]
+			r.metrics.observePublish(msgs[idx[0]].PayloadType, start, a.err)
+			switch {
+			case a.err != nil:
+				stop = stop || stopsBatch(a.err)
+			case len(idx) > 1:
+				next = append(next, idx[1:])
+			}
+		}
+		if stop {
+			return
+		}
+		parts = next
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"eventify/outbox"
 	"eventify/outbox/processors"
+	platformamqp "eventify/platform/amqp"
 	"eventify/platform/logger"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,26 +22,111 @@ const (
 	DefaultPollInterval = time.Second
 	// DefaultBatchSize is how many messages one pass claims and processes.
 	DefaultBatchSize = 100
+	// DefaultListenPollInterval is how long a relay that is LISTENing waits
+	// between polls when nothing wakes it.
+	DefaultListenPollInterval = 30 * time.Second
+	// DefaultDrainDuration bounds one drain when WithDrain is given no bound.
+	DefaultDrainDuration = 10 * time.Second
+
+	// maxListenRetry caps the wait between attempts to re-establish a dropped
+	// listener.
+	maxListenRetry = 30 * time.Second
 )
 
 // Relay polls the outbox and hands each claimed message to the processor that
 // declares its payload type.
 //
-// One instance, scaled vertically: raise batchSize before adding a replica. The
-// claim query still takes FOR UPDATE SKIP LOCKED, so a second instance would be
-// correct rather than fast — it costs one clause today and is the difference
-// between a config change and a redesign the day a single relay stops keeping up.
+// Run as many replicas as the broker needs. The claim query takes FOR UPDATE
+// SKIP LOCKED, so replicas never publish the same row, and outbox.FetchQueued
+// never lets two of them hold rows with the same partition key at once, so
+// messages that must stay in order do — see outbox.WithPartitionKey. Within
+// one replica, WithConcurrency publishes a batch's keys in parallel.
 type Relay struct {
 	db         *pgxpool.Pool
 	log        *logger.Logger
 	processors []processors.IOutboxProcessor
+	backoff    outbox.Backoff
 	interval   time.Duration
 	batchSize  int
+
+	// drainBatches and drainFor bound one Drain; see WithDrain. A zero bound
+	// does not limit.
+	drainBatches int
+	drainFor     time.Duration
+
+	// workers and partition shape how a batch is published; see
+	// WithConcurrency.
+	workers   int
+	partition PartitionFunc
+
+	// listen is set by WithListen. listening reports whether the LISTEN
+	// connection is up right now; while it is, the relay polls every
+	// listenInterval instead of every interval.
+	listen         bool
+	listenInterval time.Duration
+	listening      atomic.Bool
+
+	// metrics is set by WithMetrics, and nil without it.
+	metrics *relayMetrics
+
+	// lastPoll is when a poll last succeeded, in Unix nanoseconds; see
+	// LastPoll.
+	lastPoll atomic.Int64
+}
+
+// Option tunes a Relay beyond the poll interval and batch size every caller
+// sets.
+type Option func(*Relay)
+
+// WithBackoff sets how failed messages are spaced out before they are claimed
+// again. Without it the relay uses outbox.DefaultBackoff.
+func WithBackoff(b outbox.Backoff) Option {
+	return func(r *Relay) { r.backoff = b }
+}
+
+// WithListen makes the relay LISTEN on outbox.NotifyChannel over a dedicated
+// connection and claim new rows as soon as their transaction commits, rather
+// than at the next poll.
+//
+// Polling does not stop, it slows down: while the listener is up the relay
+// polls every pollInterval (DefaultListenPollInterval if non-positive). A poll
+// is still needed for what no insert announces — a retry whose backoff has run
+// out, a row an operator requeued — so those wait up to pollInterval rather
+// than the usual interval. If the listener drops, the relay polls at its usual
+// interval until it is re-established, so a lost connection costs latency,
+// never messages.
+func WithListen(pollInterval time.Duration) Option {
+	if pollInterval <= 0 {
+		pollInterval = DefaultListenPollInterval
+	}
+	return func(r *Relay) {
+		r.listen = true
+		r.listenInterval = pollInterval
+	}
+}
+
+// WithDrain lets one tick claim batch after batch while each comes back full,
+// instead of stopping after the first. It stops early after maxBatches batches
+// or once maxDuration has passed, whichever comes first; a non-positive bound
+// does not limit, and if neither does, DefaultDrainDuration applies.
+//
+// Without it a backlog drains one batch per poll interval: 50k rows at the
+// defaults take over eight minutes behind a healthy broker. The bounds keep a
+// drain from starving the rest of the loop — a listener's wake-ups, the
+// shutdown check — for the length of an arbitrarily large backlog.
+func WithDrain(maxDuration time.Duration, maxBatches int) Option {
+	if maxDuration <= 0 && maxBatches <= 0 {
+		maxDuration = DefaultDrainDuration
+	}
+	return func(r *Relay) {
+		r.drainFor = max(maxDuration, 0)
+		r.drainBatches = max(maxBatches, 0)
+	}
 }
 
 // New builds a Relay. A non-positive interval or batchSize takes the default.
 func New(db *pgxpool.Pool, procs []processors.IOutboxProcessor, log *logger.Logger,
-	interval time.Duration, batchSize int) *Relay {
+	interval time.Duration, batchSize int, opts ...Option) *Relay {
 
 	if interval <= 0 {
 		interval = DefaultPollInterval
@@ -46,26 +134,193 @@ func New(db *pgxpool.Pool, procs []processors.IOutboxProcessor, log *logger.Logg
 	if batchSize <= 0 {
 		batchSize = DefaultBatchSize
 	}
-	return &Relay{db: db, processors: procs, log: log, interval: interval, batchSize: batchSize}
+	r := &Relay{
+		db: db, processors: procs, log: log,
+		interval: interval, batchSize: batchSize,
+		backoff:      outbox.DefaultBackoff,
+		drainBatches: 1,
+		workers:      1,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Run processes the outbox until ctx is cancelled.
 func (r *Relay) Run(ctx context.Context) error {
-	ticker := time.NewTicker(r.interval)
-	defer ticker.Stop()
+	// wake holds at most one pending wake-up. Notifications that arrive while
+	// a batch is in flight collapse into the one poll after it, which claims
+	// every row they announced.
+	wake := make(chan struct{}, 1)
+	if r.listen {
+		go r.listenLoop(ctx, wake)
+	}
+
+	// Starting counts as progress, so a relay is not reported stuck for the
+	// first poll interval of its life.
+	r.lastPoll.Store(time.Now().UnixNano())
+
+	timer := time.NewTimer(r.interval)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
-			// A backlog larger than one batch is drained one batch per tick,
-			// rather than in a nested catch-up loop. At one instance the extra
-			// latency is bounded by the poll interval, and the loop it replaces
-			// was the hardest thing here to follow.
-			if _, err := r.ProcessTopQueued(ctx); err != nil && !errors.Is(err, context.Canceled) {
-				r.log.ErrorWithError("outbox processing failed", err)
+		case <-timer.C:
+		case <-wake:
+		}
+
+		if _, err := r.Drain(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			r.log.ErrorWithError("outbox processing failed", err)
+		}
+		timer.Reset(r.pollInterval())
+	}
+}
+
+// LastPoll returns when the relay last claimed a batch and recorded its
+// outcome without error, an empty batch included, or when Run started if it
+// has not yet. It is zero before Run.
+//
+// A relay whose last poll is old is stuck: wedged on a dead connection, or
+// failing every poll. Pinging the pool does not tell that apart from a relay
+// with nothing to do.
+func (r *Relay) LastPoll() time.Time {
+	if ns := r.lastPoll.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// pollInterval is how long Run waits for a wake-up before polling anyway.
+func (r *Relay) pollInterval() time.Duration {
+	if r.listening.Load() {
+		return r.listenInterval
+	}
+	return r.interval
+}
+
+// listenLoop keeps a LISTEN connection up until ctx is cancelled, re-dialling
+// with a capped exponential delay whenever it drops.
+func (r *Relay) listenLoop(ctx context.Context, wake chan<- struct{}) {
+	delay := time.Second
+	for {
+		established, err := r.listenOnce(ctx, wake)
+		r.listening.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		// Run's timer is armed for the slow interval. Wake it so it polls now
+		// and re-arms at the fast one.
+		signal(wake)
+		if established {
+			delay = time.Second
+		}
+		r.log.ErrorWithError("outbox listener dropped, polling every "+r.interval.String()+" until it is back", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxListenRetry)
+	}
+}
+
+// listenOnce LISTENs on outbox.NotifyChannel and signals wake for every
+// notification until the connection fails. It reports whether LISTEN was
+// established at all, so listenLoop knows whether to reset its delay.
+//
+// The connection is taken out of the pool for good. A pooled connection with a
+// LISTEN on it would be handed to ProcessTopQueued between waits and would
+// still be subscribed when it came back.
+func (r *Relay) listenOnce(ctx context.Context, wake chan<- struct{}) (bool, error) {
+	pooled, err := r.db.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("acquire listen connection: %w", err)
+	}
+	conn := pooled.Hijack()
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{outbox.NotifyChannel}.Sanitize()); err != nil {
+		return false, fmt.Errorf("listen on %s: %w", outbox.NotifyChannel, err)
+	}
+	r.listening.Store(true)
+	r.log.Info("outbox listener established on " + outbox.NotifyChannel)
+
+	// Rows committed while nobody was listening announced themselves to no
+	// one. Poll once now rather than leave them for the slower poll interval.
+	signal(wake)
+
+	for {
+		// Waiting is bounded so a connection that died silently — no RST, no
+		// error — is noticed by the ping below rather than trusted forever
+		// while the relay polls at its slow rate. A timeout leaves the
+		// connection usable.
+		waitCtx, cancel := context.WithTimeout(ctx, r.listenInterval)
+		_, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			signal(wake)
+		case ctx.Err() != nil:
+			return true, ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			if err := conn.Ping(ctx); err != nil {
+				return true, fmt.Errorf("ping listen connection: %w", err)
 			}
+		default:
+			return true, fmt.Errorf("wait for notification: %w", err)
+		}
+	}
+}
+
+// signal queues a wake-up unless one is already pending.
+func signal(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Drain processes batches back to back for as long as each one comes back
+// full, within the bounds set by WithDrain, and returns how many messages it
+// took out of the queue. Without WithDrain it processes exactly one batch.
+//
+// A batch is full when its claim selected batchSize rows, counted before the
+// partition rules in outbox.FetchQueued dropped any: a key another replica
+// holds, or a row queued behind one still backing off, shortens the batch but
+// says nothing about the rows behind it. A claim that selected fewer means the
+// queue is empty for now, and the next wake-up or poll picks up whatever
+// arrives. A claim that kept none of what it selected ends the drain too, since
+// the next one would select the same rows and drop them again.
+//
+// A batch that hit a processing failure ends the drain at once: the failure is
+// most often the broker being unreachable, and claiming the next batch would
+// only fail again.
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	start := time.Now()
+	total := 0
+	for n := 1; ; n++ {
+		b, err := r.processBatch(ctx)
+		total += b.handled
+		if err != nil {
+			return total, err
+		}
+		if b.failed || b.selected < r.batchSize || b.claimed == 0 || ctx.Err() != nil {
+			return total, nil
+		}
+		if r.drainBatches > 0 && n >= r.drainBatches {
+			return total, nil
+		}
+		if r.drainFor > 0 && time.Since(start) >= r.drainFor {
+			r.log.WithFields(logger.Fields{
+				"batches": n,
+				"handled": total,
+			}).Info("outbox drain hit its time bound with a backlog left")
+			return total, nil
 		}
 	}
 }
@@ -90,57 +345,93 @@ func (r *Relay) processorFor(m *outbox.Message) processors.IOutboxProcessor {
 // outbox guarantees at-least-once, never exactly-once. Subscribers deduplicate
 // on the payload's MessageID.
 func (r *Relay) ProcessTopQueued(ctx context.Context) (int, error) {
+	b, err := r.processBatch(ctx)
+	return b.handled, err
+}
+
+// batch is what one processBatch did: how many rows its claim selected, how
+// many of those survived the partition rules, how many of them left the queue,
+// and whether a processor failed and cut it short.
+type batch struct {
+	selected int
+	claimed  int
+	handled  int
+	failed   bool
+}
+
+// processBatch is ProcessTopQueued, reporting enough for Drain to decide
+// whether to claim another batch.
+func (r *Relay) processBatch(ctx context.Context) (batch, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("begin outbox tx: %w", err)
+		return batch{}, fmt.Errorf("begin outbox tx: %w", err)
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	msgs, err := outbox.FetchQueued(ctx, tx, r.batchSize)
+	msgs, selected, err := outbox.ClaimQueued(ctx, tx, r.batchSize)
 	if err != nil {
-		return 0, err
+		return batch{}, err
 	}
 	if len(msgs) == 0 {
-		return 0, nil
+		r.lastPoll.Store(time.Now().UnixNano())
+		return batch{selected: selected}, nil
+	}
+	start := time.Now()
+
+	attempts := make([]attempt, len(msgs))
+	for i := range msgs {
+		attempts[i].proc = r.processorFor(&msgs[i])
 	}
+	r.publishAll(ctx, msgs, attempts)
 
-	handled := 0
+	// Outcomes are recorded in claim order, whatever order the publishes
+	// finished in.
+	b := batch{selected: selected, claimed: len(msgs)}
 	for i := range msgs {
-		m := &msgs[i]
+		m, a := &msgs[i], attempts[i]
 
-		proc := r.processorFor(m)
-		if proc == nil {
+		switch {
+		case a.proc == nil:
 			// No processor claims this payload type, and none will on the next
 			// poll either. Retrying would burn attempts and hold up the queue
 			// behind it, so take it out of circulation where it can be inspected.
 			r.log.Error("no processor for " + m.PayloadType + ", poisoned message " + m.MessageID.String())
 			if err := m.Poison(ctx, tx); err != nil {
-				return 0, err
+				return batch{}, err
 			}
-			handled++
-			continue
-		}
+			b.handled++
+
+		case !a.tried:
+			// Another message failed first and the batch stopped. A failure is
+			// most often the broker being unreachable, in which case this one
+			// would fail too — and spend an attempt doing it. It keeps its
+			// status and is retried next poll.
 
-		if perr := proc.ProcessAsync(ctx, m); perr != nil {
-			if err := m.FailOrRequeue(ctx, tx); err != nil {
-				return 0, err
+		case a.err != nil:
+			f := outbox.Failure{Err: a.err, Processor: processors.Name(a.proc)}
+			if err := m.FailOrRequeue(ctx, tx, f, r.backoff); err != nil {
+				return batch{}, err
+			}
+			r.log.ErrorWithError("process "+m.PayloadType+" ("+m.Status.String()+")", a.err)
+			// Commit what did go out; this one waits out its backoff first. An
+			// unroutable message says nothing about the broker, so it does not
+			// cut a drain short.
+			if !errors.Is(a.err, platformamqp.ErrUnroutable) {
+				b.failed = true
 			}
-			r.log.ErrorWithError("process "+m.PayloadType+" ("+m.Status.String()+")", perr)
-			// Stop the batch and commit what did go out. A failure here is most
-			// often the broker being unreachable, in which case every remaining
-			// message would fail too — and each would spend an attempt doing it.
-			// The untouched rows keep their status and are retried next poll.
-			break
-		}
 
-		if err := m.Complete(ctx, tx); err != nil {
-			return 0, err
+		default:
+			if err := m.Complete(ctx, tx); err != nil {
+				return batch{}, err
+			}
+			b.handled++
 		}
-		handled++
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return 0, fmt.Errorf("commit outbox tx: %w", err)
+		return batch{}, fmt.Errorf("commit outbox tx: %w", err)
 	}
-	return handled, nil
+	r.metrics.observeBatch(start)
+	r.lastPoll.Store(time.Now().UnixNano())
+	return b, nil
 }
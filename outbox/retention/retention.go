@@ -0,0 +1,159 @@
+// Package retention moves old COMPLETED rows out of outbox_messages.
+//
+// Nothing else ever removes them. The partial index the relay claims through
+// ignores COMPLETED rows, so the relay itself stays fast, but the table and
+// every other index on it grow with all traffic ever published.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"eventify/outbox"
+	"eventify/platform/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultRetention is how long a COMPLETED row stays in outbox_messages.
+	DefaultRetention = 30 * 24 * time.Hour
+	// DefaultInterval is how long the worker sleeps between passes.
+	DefaultInterval = time.Minute
+	// DefaultBatchSize is how many rows one statement moves.
+	DefaultBatchSize = 500
+	// DefaultMaxPerPass caps the rows one pass moves, however large the
+	// backlog. The rest wait for the next pass.
+	DefaultMaxPerPass = 10_000
+)
+
+// Stats reports the worker's progress since it started.
+type Stats struct {
+	LastPassAt       time.Time
+	LastPassDuration time.Duration
+	// Archived is every row moved since start; LastPassArchived is the most
+	// recent pass alone.
+	Archived         int64
+	LastPassArchived int64
+	Passes           int64
+	FailedPasses     int64
+}
+
+// Worker archives COMPLETED rows older than its retention, in bounded batches.
+//
+// It shares the table with the relay without contending with it. The two never
+// want the same rows — the relay claims QUEUED, the worker moves COMPLETED —
+// and the worker claims with SKIP LOCKED anyway. Each batch commits on its own,
+// so no lock is held for longer than one batch, and a pass stops at maxPerPass
+// so a year of backlog is worked off over many passes rather than one long one.
+type Worker struct {
+	db         *pgxpool.Pool
+	log        *logger.Logger
+	stats      Stats
+	retention  time.Duration
+	interval   time.Duration
+	batchSize  int
+	maxPerPass int
+	mu         sync.Mutex
+}
+
+// New builds a Worker. A non-positive argument takes its default.
+func New(db *pgxpool.Pool, log *logger.Logger,
+	retention, interval time.Duration, batchSize, maxPerPass int) *Worker {
+
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if maxPerPass <= 0 {
+		maxPerPass = DefaultMaxPerPass
+	}
+	return &Worker{
+		db: db, log: log,
+		retention: retention, interval: interval,
+		batchSize: batchSize, maxPerPass: max(maxPerPass, batchSize),
+	}
+}
+
+// Run archives on every tick until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := w.RunOnce(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				w.log.ErrorWithError("outbox retention pass failed", err)
+			}
+		}
+	}
+}
+
+// RunOnce makes one pass: it archives batches until the backlog older than the
+// retention is gone or maxPerPass rows have moved, and returns how many did.
+func (w *Worker) RunOnce(ctx context.Context) (int64, error) {
+	start := time.Now()
+	cutoff := start.Add(-w.retention)
+
+	// A failure here is logged, not fatal: rows still land in the default
+	// partition, which is worse for dropping history but loses nothing.
+	if err := outbox.EnsureArchivePartitions(ctx, w.db, cutoff); err != nil {
+		w.log.ErrorWithError("ensure outbox archive partitions", err)
+	}
+
+	var moved int64
+	var err error
+	for moved < int64(w.maxPerPass) {
+		limit := min(w.batchSize, w.maxPerPass-int(moved))
+		var n int64
+		n, err = outbox.ArchiveCompleted(ctx, w.db, cutoff, limit)
+		moved += n
+		if err != nil || n < int64(limit) {
+			break
+		}
+	}
+
+	w.record(start, moved, err)
+	if err != nil {
+		return moved, fmt.Errorf("archive after %d row(s): %w", moved, err)
+	}
+	if moved > 0 {
+		w.log.WithFields(logger.Fields{
+			"archived":    moved,
+			"cutoff":      cutoff.UTC(),
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).Info("archived completed outbox messages")
+	}
+	return moved, nil
+}
+
+func (w *Worker) record(start time.Time, moved int64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Passes++
+	if err != nil {
+		w.stats.FailedPasses++
+	}
+	w.stats.Archived += moved
+	w.stats.LastPassArchived = moved
+	w.stats.LastPassAt = start
+	w.stats.LastPassDuration = time.Since(start)
+}
+
+// Stats returns a snapshot of the worker's progress.
+func (w *Worker) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
@@ -0,0 +1,215 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// stallOne leaves exactly one POISONED and one EXCEEDED row behind.
+func stallOne(t *testing.T, p *pgxpool.Pool) {
+	t.Helper()
+	ctx := context.Background()
+
+	enqueueEvents(t, p, 1)
+	failing := &fakePublisher{err: errors.New("broker down")}
+	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+		relay.WithBackoff(outbox.Backoff{}))
+	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Exceeded) == 1 })
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, "NobodyHandlesThis", uuid.New(), map[string]any{}))
+	require.NoError(t, tx.Commit(ctx))
+	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Poisoned) == 1 })
+}
+
+func TestIntegrationAdmin_ListFilters(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	stallOne(t, p)
+	enqueueEvents(t, p, 2)
+
+	all, err := outbox.List(ctx, p, outbox.Filter{})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+
+	stalled, err := outbox.List(ctx, p, outbox.Filter{Statuses: []outbox.Status{outbox.Poisoned, outbox.Exceeded}})
+	require.NoError(t, err)
+	require.Len(t, stalled, 2)
+
+	byType, err := outbox.List(ctx, p, outbox.Filter{PayloadType: "NobodyHandlesThis"})
+	require.NoError(t, err)
+	require.Len(t, byType, 1)
+	require.Equal(t, outbox.Poisoned, byType[0].Status)
+
+	byID, err := outbox.List(ctx, p, outbox.Filter{MessageIDs: []uuid.UUID{byType[0].MessageID}})
+	require.NoError(t, err)
+	require.Len(t, byID, 1)
+
+	future, err := outbox.List(ctx, p, outbox.Filter{Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, future)
+
+	limited, err := outbox.List(ctx, p, outbox.Filter{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, limited, 3)
+}
+
+// Requeue is the package doc's recovery query with a filter on it. The filter
+// must really narrow it: resetting one payload type leaves the other stalled.
+func TestIntegrationAdmin_RequeueHonoursTheFilter(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	stallOne(t, p)
+
+	n, err := outbox.Requeue(ctx, p, outbox.Filter{PayloadType: events.EventCreatedName})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, 1, countByStatus(t, p, outbox.Queued))
+	require.Equal(t, 1, countByStatus(t, p, outbox.Poisoned), "the other payload type is untouched")
+
+	var attempts int32
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT attempts FROM outbox_messages WHERE status = $1`, outbox.Queued).Scan(&attempts))
+	require.Equal(t, int32(0), attempts, "a requeued message gets its retries back")
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	claimed, err := outbox.FetchQueued(ctx, tx, 100)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1, "a requeued message is claimable at once, whatever its old backoff")
+}
+
+// A COMPLETED message was published. Requeueing it would send it again, so
+// asking to is refused rather than quietly honoured.
+func TestIntegrationAdmin_RequeueRefusesCompletedMessages(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+
+	_, err := outbox.Requeue(context.Background(), p, outbox.Filter{Statuses: []outbox.Status{outbox.Completed}})
+	require.Error(t, err)
+}
+
+func TestIntegrationAdmin_ArchiveMovesOnlyOldCompletedRows(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 3)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), 20*time.Millisecond, 100)
+	runFor(t, r, func() bool { return pub.count() == 3 })
+	enqueueEvents(t, p, 1) // still QUEUED; must never be archived
+
+	// Nothing completed before an hour ago.
+	n, err := outbox.ArchiveCompleted(ctx, p, time.Now().Add(-time.Hour), 100)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+
+	// Two per batch: the cap is honoured, and a second call finishes the job.
+	n, err = outbox.ArchiveCompleted(ctx, p, time.Now().Add(time.Minute), 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+	n, err = outbox.ArchiveCompleted(ctx, p, time.Now().Add(time.Minute), 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	require.Equal(t, 0, countByStatus(t, p, outbox.Completed))
+	require.Equal(t, 1, countByStatus(t, p, outbox.Queued))
+
+	var archived int
+	require.NoError(t, p.QueryRow(ctx, `SELECT count(*) FROM outbox_messages_archive`).Scan(&archived))
+	require.Equal(t, 3, archived)
+}
+
+// ReadStats backs the relay's outbox_messages gauges, which the package doc
+// says to alert on.
+func TestIntegrationAdmin_ReadStatsCountsByStatus(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	s, err := outbox.ReadStats(ctx, p)
+	require.NoError(t, err)
+	require.Equal(t, outbox.Stats{}, s)
+
+	stallOne(t, p)
+	enqueueEvents(t, p, 2)
+
+	s, err = outbox.ReadStats(ctx, p)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, s.Queued)
+	require.EqualValues(t, 1, s.Poisoned)
+	require.EqualValues(t, 1, s.Exceeded)
+	require.Positive(t, s.OldestQueued)
+}
+
+// ReadStats runs on every scrape, so it must not scan the COMPLETED rows it
+// leaves out. Its WHERE clause names Completed as the literal 3, which only the
+// partial index's predicate matches.
+func TestIntegrationAdmin_ReadStatsUsesThePartialIndex(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	require.Equal(t, outbox.Status(3), outbox.Completed, "ReadStats and the index spell Completed as 3")
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	// An empty table is cheapest to scan; forbid that, and see what is left.
+	_, err = tx.Exec(ctx, `SET LOCAL enable_seqscan = off`)
+	require.NoError(t, err)
+
+	var plan strings.Builder
+	rows, err := tx.Query(ctx,
+		`EXPLAIN SELECT status, count(*), min(occurred_at) FROM outbox_messages WHERE status <> 3 GROUP BY status`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var line string
+		require.NoError(t, rows.Scan(&line))
+		plan.WriteString(line + "\n")
+	}
+	require.NoError(t, rows.Err())
+	require.Contains(t, plan.String(), "idx_outbox_messages_unfinished")
+}
+
+// A row records the contract version it was encoded at. One written before
+// the column existed reads as version 1, the only version there was, and a
+// requeue leaves a row already at the current version exactly as it was.
+func TestIntegrationAdmin_RequeueKeepsACurrentPayload(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	stallOne(t, p)
+
+	msgs, err := outbox.List(ctx, p, outbox.Filter{PayloadType: events.EventCreatedName})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, events.Version(events.EventCreatedName), msgs[0].PayloadVersion)
+
+	_, err = p.Exec(ctx, `UPDATE outbox_messages SET payload_version = NULL`)
+	require.NoError(t, err)
+
+	_, err = outbox.Requeue(ctx, p, outbox.Filter{PayloadType: events.EventCreatedName})
+	require.NoError(t, err)
+
+	after, err := outbox.Find(ctx, p, msgs[0].MessageID)
+	require.NoError(t, err)
+	require.Equal(t, 1, after.PayloadVersion)
+	require.JSONEq(t, string(msgs[0].Payload), string(after.Payload))
+}
@@ -0,0 +1,145 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/processors"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// batchPublisher records each PublishBatch call, and fails any message in
+// failIDs.
+type batchPublisher struct {
+	fakePublisher
+	failIDs map[string]bool
+	batches [][]string
+	bmu     sync.Mutex
+}
+
+func (b *batchPublisher) PublishBatch(_ context.Context, msgs []processors.Outgoing) []error {
+	b.bmu.Lock()
+	defer b.bmu.Unlock()
+	ids := make([]string, len(msgs))
+	results := make([]error, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.MessageID
+		if b.failIDs[m.MessageID] {
+			results[i] = errors.New("broker rejected " + m.MessageID)
+		}
+	}
+	b.batches = append(b.batches, ids)
+	return results
+}
+
+func TestIntegrationRelay_GenericBatchIsPublishedInOneCall(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 5)
+
+	pub := &batchPublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithConcurrency(1, relay.ByPartitionKey))
+
+	n, err := r.ProcessTopQueued(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Len(t, pub.batches, 1, "unkeyed messages all go in one batch")
+	require.Len(t, pub.batches[0], 5)
+	require.Zero(t, pub.count(), "nothing may go through the single-message path")
+}
+
+// Messages sharing a key go out one wave at a time, so the second is never
+// confirmed before the first is known to have gone.
+func TestIntegrationRelay_BatchKeepsOneKeyPerWave(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	keyed := enqueueKeyed(t, p, "event-1", 3)
+	enqueueEvents(t, p, 2)
+
+	pub := &batchPublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithConcurrency(1, relay.ByPartitionKey))
+
+	n, err := r.ProcessTopQueued(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Len(t, pub.batches, 3)
+	for i, batch := range pub.batches {
+		require.Equal(t, keyed[i].String(), batch[0], "wave %d must carry the key's next message first", i)
+	}
+}
+
+// A failure ends the batch after its wave. The key's later messages are never
+// published, and neither is any later wave.
+func TestIntegrationRelay_BatchStopsAfterAFailedWave(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	keyed := enqueueKeyed(t, p, "event-1", 2)
+	other := enqueueKeyed(t, p, "event-2", 2)
+
+	pub := &batchPublisher{failIDs: map[string]bool{keyed[0].String(): true}}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithConcurrency(1, relay.ByPartitionKey))
+
+	n, err := r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n, "only event-2's first message went out")
+	require.Len(t, pub.batches, 1)
+
+	for id, want := range map[uuid.UUID]outbox.Status{
+		keyed[0]: outbox.Queued, keyed[1]: outbox.Queued,
+		other[0]: outbox.Completed, other[1]: outbox.Queued,
+	} {
+		m, err := outbox.Find(ctx, p, id)
+		require.NoError(t, err)
+		require.Equal(t, want, m.Status)
+	}
+}
+
+// passthrough is a Base processor that publishes the stored bytes, as a
+// Generic would, but that the relay cannot know does nothing else.
+type passthrough struct {
+	processors.Base[map[string]any]
+}
+
+func (p *passthrough) ProcessAsync(ctx context.Context, m *outbox.Message) error {
+	return p.Publish(ctx, m)
+}
+
+// A processor that is not a Generic might do anything before it publishes, so
+// the relay cannot publish for it; the whole batch takes the ordinary path.
+func TestIntegrationRelay_MixedProcessorsAreNotBatched(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 2)
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, "Custom", uuid.New(), map[string]any{}))
+	require.NoError(t, tx.Commit(ctx))
+
+	pub := &batchPublisher{}
+	procs := []processors.IOutboxProcessor{
+		processors.NewGeneric(pub, events.EventCreatedName),
+		&passthrough{processors.Base[map[string]any]{Pub: pub, PayloadType: "Custom"}},
+	}
+	r := relay.New(p, procs, logger.New(false), time.Hour, 100)
+
+	n, err := r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Empty(t, pub.batches)
+	require.Equal(t, 3, pub.count())
+}
@@ -0,0 +1,137 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// slowPublisher takes a while over every publish, records the order messages
+// arrive in and how many were in flight at once, and fails any message in
+// failIDs.
+type slowPublisher struct {
+	delay       time.Duration
+	failIDs     map[string]bool
+	order       []string
+	inFlight    int
+	maxInFlight int
+	mu          sync.Mutex
+}
+
+func (s *slowPublisher) Publish(_ context.Context, _, messageID string, _ []byte) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.failIDs[messageID] {
+		return errors.New("broker rejected " + messageID)
+	}
+	s.order = append(s.order, messageID)
+	return nil
+}
+
+// enqueueFor writes n EventCreated rows about one aggregate, keyed by it, one
+// transaction each, and returns their message IDs in enqueue order.
+func enqueueFor(t *testing.T, p *pgxpool.Pool, aggregate uuid.UUID, n int) []string {
+	t.Helper()
+	ctx := context.Background()
+	var ids []string
+	for range n {
+		messageID := uuid.New()
+		tx, err := p.Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, outbox.Enqueue(ctx, tx, events.EventCreatedName, messageID, events.EventCreated{
+			MessageID: messageID, ID: aggregate, Name: "Summer Gala", OccurredAt: time.Now().UTC(),
+		}, outbox.WithPartitionKey(aggregate.String())))
+		require.NoError(t, tx.Commit(ctx))
+		ids = append(ids, messageID.String())
+	}
+	return ids
+}
+
+// only keeps the entries of got that appear in want, in got's order.
+func only(got, want []string) []string {
+	keep := map[string]bool{}
+	for _, id := range want {
+		keep[id] = true
+	}
+	var out []string
+	for _, id := range got {
+		if keep[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func TestIntegrationRelay_ConcurrentBatchKeepsPerKeyOrder(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+
+	var perKey [][]string
+	for range 4 {
+		perKey = append(perKey, enqueueFor(t, p, uuid.New(), 5))
+	}
+
+	pub := &slowPublisher{delay: 20 * time.Millisecond}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithConcurrency(4, relay.ByPartitionKey))
+
+	n, err := r.ProcessTopQueued(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 20, n)
+	require.Equal(t, 20, countByStatus(t, p, outbox.Completed))
+
+	require.Greater(t, pub.maxInFlight, 1, "different keys must be published concurrently")
+	for _, want := range perKey {
+		require.Equal(t, want, only(pub.order, want), "one key's messages must go out in enqueue order")
+	}
+}
+
+// A failure stops its own partition where it is — nothing after it may
+// overtake it — and the rest of the batch starts nothing new. Whatever did go
+// out is still recorded as COMPLETED in the same transaction.
+func TestIntegrationRelay_ConcurrentBatchStopsOnAFailure(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	failing := enqueueFor(t, p, uuid.New(), 3)
+
+	pub := &slowPublisher{failIDs: map[string]bool{failing[0]: true}}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithConcurrency(4, relay.ByPartitionKey))
+
+	n, err := r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Empty(t, pub.order, "nothing behind the failure may be published")
+
+	for i, id := range failing {
+		m, err := outbox.Find(ctx, p, uuid.MustParse(id))
+		require.NoError(t, err)
+		require.Equal(t, outbox.Queued, m.Status)
+		if i == 0 {
+			require.Equal(t, int32(1), m.Attempts, "the failed message spends its attempt")
+		} else {
+			require.Equal(t, int32(0), m.Attempts, "messages behind it are left untouched")
+		}
+	}
+}
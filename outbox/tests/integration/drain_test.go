@@ -0,0 +1,187 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"eventify/outbox"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyPublisher accepts okFor messages, then rejects every one after, and
+// counts every call either way.
+type flakyPublisher struct {
+	okFor int
+	calls int
+	mu    sync.Mutex
+}
+
+func (f *flakyPublisher) Publish(context.Context, string, string, []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls > f.okFor {
+		return errors.New("broker down")
+	}
+	return nil
+}
+
+func (f *flakyPublisher) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// attemptedCount reports how many rows have spent at least one attempt.
+func attemptedCount(t *testing.T, p *pgxpool.Pool) int {
+	t.Helper()
+	var n int
+	require.NoError(t, p.QueryRow(context.Background(),
+		`SELECT count(*) FROM outbox_messages WHERE attempts > 0`).Scan(&n))
+	return n
+}
+
+func TestIntegrationRelay_DrainClearsABacklogInOneCall(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 250)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithDrain(time.Minute, 0))
+
+	n, err := r.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 250, n, "full batches must be followed by another at once")
+	require.Equal(t, 250, countByStatus(t, p, outbox.Completed))
+}
+
+func TestIntegrationRelay_DrainStopsAtMaxBatches(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 250)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithDrain(0, 2))
+
+	n, err := r.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 200, n)
+	require.Equal(t, 50, countByStatus(t, p, outbox.Queued), "the rest waits for the next tick")
+}
+
+// Without WithDrain a tick is one batch, as it always was.
+func TestIntegrationRelay_DrainWithoutTheOptionIsOneBatch(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 150)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100)
+
+	n, err := r.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 100, n)
+}
+
+// A failure part-way through the second batch ends the drain there. The batch
+// commits what went out before the failure, and no third batch is claimed: the
+// rows behind it are not touched, so they spend no attempts on a broker that is
+// rejecting everything.
+func TestIntegrationRelay_DrainStopsImmediatelyOnAProcessingFailure(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 300)
+
+	pub := &flakyPublisher{okFor: 150}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithDrain(time.Minute, 0))
+
+	n, err := r.Drain(context.Background())
+	require.NoError(t, err, "a processing failure is recorded on the row, not returned")
+	require.Equal(t, 150, n)
+	require.Equal(t, 151, pub.callCount(), "nothing may be published after the failure")
+	require.Equal(t, 150, countByStatus(t, p, outbox.Completed))
+	require.Equal(t, 150, countByStatus(t, p, outbox.Queued))
+	require.Equal(t, 1, attemptedCount(t, p), "only the failed message spends an attempt")
+}
+
+// The same holds when the very first message fails: one publish, one attempt,
+// and the drain returns rather than retrying.
+func TestIntegrationRelay_DrainStopsOnAFailureInTheFirstBatch(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	enqueueEvents(t, p, 250)
+
+	pub := &flakyPublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithDrain(time.Minute, 0), relay.WithBackoff(outbox.Backoff{}))
+
+	n, err := r.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, 1, pub.callCount())
+	require.Equal(t, 1, attemptedCount(t, p))
+	require.Equal(t, 250, countByStatus(t, p, outbox.Queued))
+}
+
+// A key another replica holds shortens every batch that reaches it, but the
+// queue behind it is not empty. The drain keeps claiming as long as its claims
+// come back full before the key's rows are dropped, and leaves those rows to
+// whichever replica holds the key.
+func TestIntegrationRelay_DrainContinuesPastAKeyHeldElsewhere(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueKeyed(t, p, "event-1", 5)
+	enqueueEvents(t, p, 25)
+
+	holder, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = holder.Rollback(ctx) }()
+	held, err := outbox.FetchQueued(ctx, holder, 1)
+	require.NoError(t, err)
+	require.Len(t, held, 1)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 10,
+		relay.WithDrain(time.Minute, 0))
+
+	n, err := r.Drain(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 25, n, "a batch shortened by a held key must not end the drain")
+	require.Equal(t, 25, countByStatus(t, p, outbox.Completed))
+	require.Equal(t, 5, countByStatus(t, p, outbox.Queued), "the held key's rows wait for its holder")
+}
+
+// ClaimQueued reports the rows a claim selected, not only those it kept, so
+// a caller can tell a queue that ran dry from one a held key cut short.
+func TestIntegrationClaimQueued_CountsRowsDroppedByAHeldKey(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueKeyed(t, p, "event-1", 3)
+	enqueueEvents(t, p, 2)
+
+	holder, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = holder.Rollback(ctx) }()
+	_, err = outbox.FetchQueued(ctx, holder, 1)
+	require.NoError(t, err)
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	msgs, selected, err := outbox.ClaimQueued(ctx, tx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, 4, selected, "the key's unclaimed rows are selected, then dropped")
+}
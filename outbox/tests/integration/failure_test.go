@@ -0,0 +1,127 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// onlyMessageID returns the message_id of the single row in outbox_messages.
+func onlyMessageID(t *testing.T, p *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+	var id uuid.UUID
+	require.NoError(t, p.QueryRow(context.Background(),
+		`SELECT message_id FROM outbox_messages`).Scan(&id))
+	return id
+}
+
+// When a message goes EXCEEDED, the reason must be on the row, not only in the
+// log of whichever replica made the last attempt.
+func TestIntegrationOutbox_ExceededMessageRecordsWhyItFailed(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 1)
+
+	failing := &fakePublisher{err: errors.New("broker down")}
+	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+		relay.WithBackoff(outbox.Backoff{}))
+	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Exceeded) == 1 })
+
+	messageID := onlyMessageID(t, p)
+	m, err := outbox.Find(ctx, p, messageID)
+	require.NoError(t, err)
+	require.Equal(t, outbox.Exceeded, m.Status)
+	require.Contains(t, m.LastError, "broker down")
+	require.NotNil(t, m.LastErrorAt)
+
+	history, err := outbox.FailureHistory(ctx, p, messageID)
+	require.NoError(t, err)
+	require.Len(t, history, outbox.MaxAttempts, "one record per failed attempt")
+	for i, f := range history {
+		require.Equal(t, int32(i+1), f.Attempt, "history reads oldest first")
+		require.Equal(t, "Generic("+events.EventCreatedName+")", f.Processor)
+		require.Contains(t, f.Error, "broker down")
+	}
+}
+
+// A poisoned message never reached a processor, but it still says why it
+// stopped.
+func TestIntegrationOutbox_PoisonedMessageRecordsWhy(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	messageID := uuid.New()
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, "NobodyHandlesThis", messageID, map[string]any{}))
+	require.NoError(t, tx.Commit(ctx))
+
+	r := relay.New(p, eventCreatedProcessors(&fakePublisher{}), logger.New(false), 20*time.Millisecond, 100)
+	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Poisoned) == 1 })
+
+	m, err := outbox.Find(ctx, p, messageID)
+	require.NoError(t, err)
+	require.Contains(t, m.LastError, "NobodyHandlesThis")
+
+	history, err := outbox.FailureHistory(ctx, p, messageID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Empty(t, history[0].Processor, "no processor was involved")
+	require.Equal(t, int32(0), history[0].Attempt, "poisoning is not an attempt")
+}
+
+// An operator may reset a failing message many times. Its history is capped,
+// keeping the newest entries.
+func TestIntegrationOutbox_FailureHistoryIsBounded(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 1)
+
+	failing := &fakePublisher{err: errors.New("broker down")}
+	for range 3 {
+		r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+			relay.WithBackoff(outbox.Backoff{}))
+		runFor(t, r, func() bool { return countByStatus(t, p, outbox.Exceeded) == 1 })
+		_, err := p.Exec(ctx, `UPDATE outbox_messages SET status = 1, attempts = 0 WHERE status IN (2, 4)`)
+		require.NoError(t, err)
+	}
+
+	history, err := outbox.FailureHistory(ctx, p, onlyMessageID(t, p))
+	require.NoError(t, err)
+	require.Len(t, history, outbox.FailureHistoryLimit)
+	require.Equal(t, int32(outbox.MaxAttempts), history[len(history)-1].Attempt,
+		"the newest failure survives pruning")
+}
+
+// A completed message has no error to report.
+func TestIntegrationOutbox_FindReportsNoErrorForACompletedMessage(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 1)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), 20*time.Millisecond, 100)
+	runFor(t, r, func() bool { return pub.count() == 1 })
+
+	m, err := outbox.Find(ctx, p, onlyMessageID(t, p))
+	require.NoError(t, err)
+	require.Equal(t, outbox.Completed, m.Status)
+	require.Empty(t, m.LastError)
+
+	_, err = outbox.Find(ctx, p, uuid.New())
+	require.ErrorIs(t, err, outbox.ErrNotFound)
+}
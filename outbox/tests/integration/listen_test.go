@@ -0,0 +1,86 @@
+package relay_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// startRelay runs r in the background until the test ends.
+func startRelay(t *testing.T, r *relay.Relay) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { defer close(done); _ = r.Run(ctx) }()
+	t.Cleanup(func() { cancel(); <-done })
+}
+
+// listenerPID waits for the relay's LISTEN connection to appear and returns its
+// backend pid.
+func listenerPID(t *testing.T, p *pgxpool.Pool) int32 {
+	t.Helper()
+	var pid int32
+	require.Eventually(t, func() bool {
+		err := p.QueryRow(context.Background(),
+			`SELECT pid FROM pg_stat_activity WHERE query = 'LISTEN "outbox_messages"'`).Scan(&pid)
+		return err == nil
+	}, 10*time.Second, 20*time.Millisecond, "the relay never started listening")
+	return pid
+}
+
+// With an hour between polls, only a notification can get these rows out in
+// seconds. The second row is enqueued after the listener is up, so it cannot
+// have been caught by the poll the relay makes when it first starts listening.
+func TestIntegrationRelay_NotifyWakesTheRelayBeforeItsPoll(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100,
+		relay.WithListen(time.Hour))
+	startRelay(t, r)
+	listenerPID(t, p)
+
+	enqueueEvents(t, p, 1)
+	require.Eventually(t, func() bool { return pub.count() == 1 }, 5*time.Second, 20*time.Millisecond)
+
+	enqueueEvents(t, p, 1)
+	require.Eventually(t, func() bool { return pub.count() == 2 }, 5*time.Second, 20*time.Millisecond,
+		"a commit after the listener is up must wake the relay")
+}
+
+// Killing the LISTEN connection must cost latency, never messages: the relay
+// goes back to its fast poll until the listener is re-established.
+func TestIntegrationRelay_DroppedListenerFallsBackToPolling(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), 50*time.Millisecond, 100,
+		relay.WithListen(time.Hour))
+	startRelay(t, r)
+
+	pid := listenerPID(t, p)
+	_, err := p.Exec(ctx, `SELECT pg_terminate_backend($1)`, pid)
+	require.NoError(t, err)
+
+	enqueueEvents(t, p, 3)
+	require.Eventually(t, func() bool { return pub.count() == 3 }, 5*time.Second, 20*time.Millisecond,
+		"rows enqueued while the listener is down must still be published")
+
+	// And it comes back, on a new connection.
+	require.Eventually(t, func() bool {
+		var n int
+		_ = p.QueryRow(ctx,
+			`SELECT count(*) FROM pg_stat_activity WHERE query = 'LISTEN "outbox_messages"' AND pid <> $1`,
+			pid).Scan(&n)
+		return n == 1
+	}, 10*time.Second, 50*time.Millisecond, "the relay must re-establish its listener")
+}
@@ -0,0 +1,134 @@
+package relay_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// enqueueKeyed writes n EventCreated rows under one partition key, one
+// transaction each, and returns their message IDs in enqueue order.
+func enqueueKeyed(t *testing.T, p *pgxpool.Pool, key string, n int) []uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	var ids []uuid.UUID
+	for range n {
+		messageID := uuid.New()
+		tx, err := p.Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, outbox.Enqueue(ctx, tx, events.EventCreatedName, messageID,
+			events.EventCreated{MessageID: messageID, OccurredAt: time.Now().UTC()},
+			outbox.WithPartitionKey(key)))
+		require.NoError(t, tx.Commit(ctx))
+		ids = append(ids, messageID)
+	}
+	return ids
+}
+
+func messageIDs(msgs []outbox.Message) []uuid.UUID {
+	var out []uuid.UUID
+	for _, m := range msgs {
+		out = append(out, m.MessageID)
+	}
+	return out
+}
+
+// While one transaction holds a key, a second claims around it: it takes the
+// unkeyed rows, and none of the key's, even those the first did not claim.
+func TestIntegrationFetchQueued_NeverSplitsAKeyAcrossTransactions(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	keyed := enqueueKeyed(t, p, "event-1", 3)
+	enqueueEvents(t, p, 2)
+
+	first, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = first.Rollback(ctx) }()
+	claimed, err := outbox.FetchQueued(ctx, first, 1)
+	require.NoError(t, err)
+	require.Equal(t, keyed[:1], messageIDs(claimed))
+	require.Equal(t, "event-1", claimed[0].PartitionKey)
+
+	second, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = second.Rollback(ctx) }()
+	others, err := outbox.FetchQueued(ctx, second, 10)
+	require.NoError(t, err)
+	require.Len(t, others, 2, "only the unkeyed rows may be claimed")
+	for _, m := range others {
+		require.Empty(t, m.PartitionKey)
+	}
+}
+
+// Once the holder commits, the next claim picks the key up where it left off,
+// in enqueue order.
+func TestIntegrationFetchQueued_KeyResumesInOrderAfterItsHolderCommits(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	keyed := enqueueKeyed(t, p, "event-1", 3)
+
+	first, err := p.Begin(ctx)
+	require.NoError(t, err)
+	claimed, err := outbox.FetchQueued(ctx, first, 1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, claimed[0].Complete(ctx, first))
+	require.NoError(t, first.Commit(ctx))
+
+	second, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = second.Rollback(ctx) }()
+	rest, err := outbox.FetchQueued(ctx, second, 10)
+	require.NoError(t, err)
+	require.Equal(t, keyed[1:], messageIDs(rest))
+}
+
+// A row backing off after a failure still holds its key: publishing the row
+// behind it first would deliver the key's messages out of order.
+func TestIntegrationFetchQueued_BackingOffRowHoldsBackItsKey(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	keyed := enqueueKeyed(t, p, "event-1", 2)
+
+	_, err := p.Exec(ctx,
+		`UPDATE outbox_messages SET attempts = 1, next_attempt_at = now() + interval '1 hour'
+		  WHERE message_id = $1`, keyed[0])
+	require.NoError(t, err)
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	claimed, err := outbox.FetchQueued(ctx, tx, 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+}
+
+// A row that has left the queue for good does not hold its key forever.
+func TestIntegrationFetchQueued_StoppedRowReleasesItsKey(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	keyed := enqueueKeyed(t, p, "event-1", 2)
+
+	_, err := p.Exec(ctx,
+		`UPDATE outbox_messages SET status = $1 WHERE message_id = $2`, outbox.Exceeded, keyed[0])
+	require.NoError(t, err)
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	claimed, err := outbox.FetchQueued(ctx, tx, 10)
+	require.NoError(t, err)
+	require.Equal(t, keyed[1:], messageIDs(claimed))
+}
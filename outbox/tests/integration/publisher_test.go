@@ -0,0 +1,239 @@
+package relay_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/processors"
+	"eventify/outbox/relay"
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// broker starts the RabbitMQ image docker-compose runs and returns its AMQP
+// URI. The fakePublisher covers what the relay does with a publish's outcome;
+// only a broker can say whether the Publisher reports that outcome truthfully.
+func broker(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "rabbitmq:3-management",
+			ExposedPorts: []string{"5672/tcp"},
+			WaitingFor: wait.ForLog("Server startup complete").
+				WithStartupTimeout(90 * time.Second),
+		},
+		Started: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = container.Terminate(context.Background()) })
+
+	endpoint, err := container.PortEndpoint(ctx, "5672/tcp", "")
+	require.NoError(t, err)
+	return fmt.Sprintf("amqp://guest:guest@%s/", endpoint)
+}
+
+// publisher dials uri, which also declares the exchange a test binds to.
+func publisher(t *testing.T, uri string) *platformamqp.Publisher {
+	t.Helper()
+	pub, err := platformamqp.NewPublisher(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pub.Close() })
+	return pub
+}
+
+// channel opens a channel of the test's own, beside the publisher's.
+func channel(t *testing.T, uri string) *amqp.Channel {
+	t.Helper()
+	conn, err := amqp.Dial(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+	return ch
+}
+
+// bind declares a queue for the test and binds it to key on the exchange.
+func bind(t *testing.T, ch *amqp.Channel, key string) string {
+	t.Helper()
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	require.NoError(t, err)
+	require.NoError(t, ch.QueueBind(q.Name, key, platformamqp.ExchangeName, false, nil))
+	return q.Name
+}
+
+// queued takes every message in queue and returns their message IDs in order.
+func queued(t *testing.T, ch *amqp.Channel, queue string) []string {
+	t.Helper()
+	var ids []string
+	for {
+		d, ok, err := ch.Get(queue, true)
+		require.NoError(t, err)
+		if !ok {
+			return ids
+		}
+		ids = append(ids, d.MessageId)
+	}
+}
+
+// bounded fails the test instead of letting it hang on a publish that never
+// returns.
+func bounded(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// The broker drops a message no queue is bound for. Publish must say so, or
+// the relay marks its row COMPLETED and the event is gone.
+func TestIntegrationPublisher_ReportsAnUnroutableMessage(t *testing.T) {
+	skipUnlessDocker(t)
+	pub := publisher(t, broker(t))
+
+	err := pub.Publish(bounded(t), "eventify.events.Unbound", uuid.NewString(), []byte(`{}`))
+	require.ErrorIs(t, err, platformamqp.ErrUnroutable)
+}
+
+// A nil error means the broker confirmed the message, and it confirms a
+// routed message only once every queue it was routed to holds it.
+func TestIntegrationPublisher_ReturnsOnceARoutedMessageIsConfirmed(t *testing.T) {
+	skipUnlessDocker(t)
+	uri := broker(t)
+	pub := publisher(t, uri)
+	ch := channel(t, uri)
+	queue := bind(t, ch, "eventify.events.EventCreated")
+
+	id := uuid.NewString()
+	require.NoError(t, pub.Publish(bounded(t), "eventify.events.EventCreated", id, []byte(`{}`)))
+	require.Equal(t, []string{id}, queued(t, ch, queue), "a confirmed message is already in its queue")
+}
+
+// A channel that closes under a publish fails the message waiting on it with
+// ErrClosed, rather than leaving Publish waiting for a confirm that will never
+// come. The next publish dials a fresh channel.
+//
+// Deleting the exchange is how the test closes the channel: the broker closes
+// a channel that publishes to an exchange it does not have, after the
+// publish has been written and while its confirm is awaited.
+func TestIntegrationPublisher_FailsWithErrClosedWhenTheChannelCloses(t *testing.T) {
+	skipUnlessDocker(t)
+	uri := broker(t)
+	pub := publisher(t, uri)
+	require.NoError(t, channel(t, uri).ExchangeDelete(platformamqp.ExchangeName, false, false))
+
+	err := pub.Publish(bounded(t), "eventify.events.EventCreated", uuid.NewString(), []byte(`{}`))
+	require.ErrorIs(t, err, platformamqp.ErrClosed)
+	require.False(t, errors.Is(err, context.DeadlineExceeded), "Publish must not wait out its timeout")
+
+	// The redial declares the exchange again; with nothing bound, the broker
+	// answers — which is the point — with a return.
+	err = pub.Publish(bounded(t), "eventify.events.EventCreated", uuid.NewString(), []byte(`{}`))
+	require.ErrorIs(t, err, platformamqp.ErrUnroutable)
+}
+
+func outgoing(key string) platformamqp.Outgoing {
+	return platformamqp.Outgoing{RoutingKey: key, MessageID: uuid.NewString(), Body: []byte(`{}`)}
+}
+
+// Each result belongs to the message at its index. A return is matched to the
+// message it was for, not to whichever confirm arrives next, so the messages
+// either side of an unroutable one are still reported as sent — and are, in
+// the order they were given.
+func TestIntegrationPublisher_PublishBatchReportsEachMessageAtItsIndex(t *testing.T) {
+	skipUnlessDocker(t)
+	uri := broker(t)
+	pub := publisher(t, uri)
+	ch := channel(t, uri)
+	queue := bind(t, ch, "eventify.events.EventCreated")
+
+	batch := []platformamqp.Outgoing{
+		outgoing("eventify.events.EventCreated"),
+		outgoing("eventify.events.Unbound"),
+		outgoing("eventify.events.EventCreated"),
+		outgoing("eventify.events.Unbound"),
+		outgoing("eventify.events.EventCreated"),
+	}
+	results := pub.PublishBatch(bounded(t), batch)
+
+	require.Len(t, results, len(batch))
+	for i, err := range results {
+		if i%2 == 1 {
+			require.ErrorIs(t, err, platformamqp.ErrUnroutable, "message %d", i)
+		} else {
+			require.NoError(t, err, "message %d", i)
+		}
+	}
+	require.Equal(t, []string{batch[0].MessageID, batch[2].MessageID, batch[4].MessageID}, queued(t, ch, queue))
+}
+
+// A channel that closes part-way through a batch fails the message that
+// closed it with ErrClosed, and no message in the batch is reported as sent or
+// left waiting out the confirm timeout.
+func TestIntegrationPublisher_PublishBatchFailsEveryMessageWhenTheChannelCloses(t *testing.T) {
+	skipUnlessDocker(t)
+	uri := broker(t)
+	pub := publisher(t, uri)
+	require.NoError(t, channel(t, uri).ExchangeDelete(platformamqp.ExchangeName, false, false))
+
+	results := pub.PublishBatch(bounded(t), []platformamqp.Outgoing{
+		outgoing("eventify.events.EventCreated"),
+		outgoing("eventify.events.EventCreated"),
+		outgoing("eventify.events.EventCreated"),
+	})
+
+	require.ErrorIs(t, results[0], platformamqp.ErrClosed)
+	for i, err := range results {
+		// The messages after the first either met the closed channel or a
+		// fresh one with nothing bound; neither went anywhere.
+		require.Error(t, err, "message %d", i)
+		require.False(t, errors.Is(err, context.DeadlineExceeded), "message %d waited out its timeout", i)
+	}
+}
+
+// Through the relay, the per-message results decide each row: a routed message
+// completes, and an unroutable one beside it in the same batch stays queued
+// with the attempt it spent.
+func TestIntegrationRelay_BatchAgainstABrokerRecordsEachOutcome(t *testing.T) {
+	skipUnlessDocker(t)
+	uri := broker(t)
+	p := pool(t)
+	ctx := context.Background()
+	pub := publisher(t, uri)
+	bind(t, channel(t, uri), events.RoutingKey(events.EventCreatedName))
+
+	enqueueEvents(t, p, 2)
+	deletedID := uuid.New()
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, events.EventDeletedName, deletedID,
+		events.EventDeleted{MessageID: deletedID, ID: uuid.New(), OccurredAt: time.Now().UTC()}))
+	require.NoError(t, tx.Commit(ctx))
+
+	r := relay.New(p, []processors.IOutboxProcessor{
+		processors.NewGeneric(pub, events.EventCreatedName),
+		processors.NewGeneric(pub, events.EventDeletedName),
+	}, logger.New(false), time.Hour, 100)
+
+	n, err := r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 2, countByStatus(t, p, outbox.Completed))
+	m, err := outbox.Find(ctx, p, deletedID)
+	require.NoError(t, err)
+	require.Equal(t, outbox.Queued, m.Status)
+	require.Equal(t, int32(1), m.Attempts)
+	require.Contains(t, m.LastError, platformamqp.ErrUnroutable.Error())
+}
@@ -26,9 +26,11 @@ func TestIntegrationOutbox_DocumentedRecoveryQueryRequeuesStalledMessages(t *tes
 	ctx := context.Background()
 
 	// One message nothing can publish, because the broker is down -> EXCEEDED.
+	// The zero Backoff spends its attempts in milliseconds rather than minutes.
 	enqueueEvents(t, p, 1)
 	failing := &fakePublisher{err: errors.New("broker down")}
-	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100)
+	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+		relay.WithBackoff(outbox.Backoff{}))
 	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Exceeded) == 1 })
 
 	// One message no processor claims -> POISONED.
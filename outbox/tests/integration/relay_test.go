@@ -3,6 +3,7 @@ package relay_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 	"eventify/outbox"
 	"eventify/outbox/processors"
 	"eventify/outbox/relay"
+	platformamqp "eventify/platform/amqp"
 	"eventify/platform/logger"
 
 	"github.com/google/uuid"
@@ -212,8 +214,8 @@ func TestIntegrationRelay_PublishFailureRequeuesForRetry(t *testing.T) {
 	p := pool(t)
 	enqueueEvents(t, p, 3)
 
-	// Poll slowly enough that the brief outage below cannot spend all
-	// MaxAttempts — attempts are consumed one per poll, with no delay between.
+	// The default backoff holds a failed row back for about a second, so the
+	// brief outage below spends at most one attempt per message.
 	failing := &fakePublisher{err: errors.New("broker down")}
 	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 50*time.Millisecond, 100)
 
@@ -237,15 +239,16 @@ func TestIntegrationRelay_PublishFailureRequeuesForRetry(t *testing.T) {
 // A message that keeps failing eventually stops being retried, rather than
 // looping forever behind a broker that will never accept it.
 //
-// Note the coupling this asserts: attempts are spent one per poll, with no
-// delay. A relay polling every 10ms exceeds a message in 100ms of downtime.
+// The zero Backoff retries on every poll, so a relay polling every 10ms
+// exceeds a message in 100ms of downtime rather than eight minutes.
 func TestIntegrationRelay_ExhaustedRetriesStopTheMessage(t *testing.T) {
 	skipUnlessDocker(t)
 	p := pool(t)
 	enqueueEvents(t, p, 1)
 
 	failing := &fakePublisher{err: errors.New("broker down")}
-	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100)
+	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+		relay.WithBackoff(outbox.Backoff{}))
 
 	runFor(t, r, func() bool { return countByStatus(t, p, outbox.Exceeded) == 1 })
 
@@ -258,6 +261,41 @@ func TestIntegrationRelay_ExhaustedRetriesStopTheMessage(t *testing.T) {
 	require.Equal(t, int32(outbox.MaxAttempts), attempts)
 }
 
+// A failed message is held back until its next_attempt_at, rather than being
+// claimed on the very next poll. Without that, a relay polling every 10ms would
+// spend every attempt in the first 100ms of an outage.
+func TestIntegrationRelay_FailedMessageWaitsOutItsBackoff(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 1)
+
+	failing := &fakePublisher{err: errors.New("broker down")}
+	r := relay.New(p, eventCreatedProcessors(failing), logger.New(false), 10*time.Millisecond, 100,
+		relay.WithBackoff(outbox.Backoff{Base: time.Hour, Max: time.Hour}))
+
+	runCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_ = r.Run(runCtx)
+
+	var (
+		attempts      int32
+		nextAttemptAt time.Time
+	)
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT attempts, next_attempt_at FROM outbox_messages`).Scan(&attempts, &nextAttemptAt))
+	require.Equal(t, int32(1), attempts, "twenty polls must not spend twenty attempts")
+	require.Greater(t, time.Until(nextAttemptAt), 30*time.Minute, "the row must be pushed out by its backoff")
+	require.Equal(t, 1, countByStatus(t, p, outbox.Queued), "backing off is still queued, not exceeded")
+
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	claimed, err := outbox.FetchQueued(ctx, tx, 100)
+	require.NoError(t, err)
+	require.Empty(t, claimed, "a row backing off must not be claimable")
+}
+
 // An event no processor claims can never succeed. Retrying it burns attempts
 // and holds up the queue, so it is taken out of circulation immediately.
 func TestIntegrationRelay_UnclaimedEventIsPoisoned(t *testing.T) {
@@ -301,3 +339,63 @@ func TestIntegrationEnqueue_RollsBackWithTheCallersTransaction(t *testing.T) {
 	require.Equal(t, 0, countByStatus(t, p, outbox.Queued),
 		"a rolled-back transaction must leave no outbox row")
 }
+
+// unroutablePublisher reports every message in ids as unroutable, the way the
+// amqp Publisher does when no queue is bound to its key, and accepts the rest.
+type unroutablePublisher struct {
+	fakePublisher
+	ids map[string]bool
+}
+
+func (u *unroutablePublisher) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	if u.ids[messageID] {
+		return fmt.Errorf("publish %s: %w: NO_ROUTE (312)", routingKey, platformamqp.ErrUnroutable)
+	}
+	return u.fakePublisher.Publish(ctx, routingKey, messageID, body)
+}
+
+// An unroutable message is that message's problem, not the broker's. It spends
+// an attempt and records why, and the messages behind it still go out.
+func TestIntegrationRelay_UnroutableMessageDoesNotStopTheBatch(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueEvents(t, p, 3)
+
+	first, err := outbox.List(ctx, p, outbox.Filter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	pub := &unroutablePublisher{ids: map[string]bool{first[0].MessageID.String(): true}}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100)
+
+	n, err := r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 2, countByStatus(t, p, outbox.Completed))
+
+	m, err := outbox.Find(ctx, p, first[0].MessageID)
+	require.NoError(t, err)
+	require.Equal(t, outbox.Queued, m.Status)
+	require.Equal(t, int32(1), m.Attempts)
+	require.Contains(t, m.LastError, "unroutable")
+}
+
+// LastPoll backs the relay's liveness probe: it moves on every successful
+// poll, whether or not the poll found anything.
+func TestIntegrationRelay_LastPollAdvancesOnEmptyPolls(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+
+	r := relay.New(p, eventCreatedProcessors(&fakePublisher{}), logger.New(false), 10*time.Millisecond, 100)
+	require.True(t, r.LastPoll().IsZero(), "a relay that never ran has not polled")
+
+	var started time.Time
+	runFor(t, r, func() bool {
+		if started.IsZero() {
+			started = r.LastPoll()
+			return false
+		}
+		return r.LastPoll().After(started)
+	})
+}
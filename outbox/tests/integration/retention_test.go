@@ -0,0 +1,167 @@
+package relay_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/relay"
+	"eventify/outbox/retention"
+	"eventify/platform/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// completeAll drains n fresh rows and backdates their completion by age.
+func completeAll(t *testing.T, p *pgxpool.Pool, n int, age time.Duration) {
+	t.Helper()
+	enqueueEvents(t, p, n)
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), 10*time.Millisecond, 100)
+	runFor(t, r, func() bool { return pub.count() == n })
+
+	_, err := p.Exec(context.Background(),
+		`UPDATE outbox_messages SET completed_at = now() - $1::interval WHERE status = $2`,
+		age.String(), outbox.Completed)
+	require.NoError(t, err)
+}
+
+func archivedCount(t *testing.T, p *pgxpool.Pool) int {
+	t.Helper()
+	var n int
+	require.NoError(t, p.QueryRow(context.Background(),
+		`SELECT count(*) FROM outbox_messages_archive`).Scan(&n))
+	return n
+}
+
+// One pass must stop at its cap however large the backlog, so that archiving a
+// year of history never turns into one long pass beside the relay.
+func TestIntegrationRetention_PassIsCappedAndResumes(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	completeAll(t, p, 7, 48*time.Hour)
+
+	w := retention.New(p, logger.New(false), 24*time.Hour, time.Hour, 2, 5)
+
+	n, err := w.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n, "the pass stops at maxPerPass")
+	require.Equal(t, 2, countByStatus(t, p, outbox.Completed))
+
+	n, err = w.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n, "the next pass finishes the backlog")
+	require.Equal(t, 7, archivedCount(t, p))
+
+	stats := w.Stats()
+	require.Equal(t, int64(2), stats.Passes)
+	require.Equal(t, int64(7), stats.Archived)
+	require.Equal(t, int64(2), stats.LastPassArchived)
+	require.Zero(t, stats.FailedPasses)
+}
+
+// Recent completions and anything not yet completed stay where the relay and
+// on-call expect them.
+func TestIntegrationRetention_KeepsRecentAndUnfinishedRows(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	completeAll(t, p, 2, time.Hour)
+	enqueueEvents(t, p, 1)
+
+	w := retention.New(p, logger.New(false), 24*time.Hour, time.Hour, 100, 1000)
+	n, err := w.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Equal(t, 2, countByStatus(t, p, outbox.Completed))
+	require.Equal(t, 1, countByStatus(t, p, outbox.Queued))
+}
+
+// Archived rows land in their month's partition, not the default one, so that
+// dropping old history stays a DROP TABLE.
+func TestIntegrationRetention_ArchivesIntoMonthlyPartitions(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	completeAll(t, p, 1, 48*time.Hour)
+
+	w := retention.New(p, logger.New(false), 24*time.Hour, time.Hour, 100, 1000)
+	_, err := w.RunOnce(ctx)
+	require.NoError(t, err)
+
+	var partition string
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT tableoid::regclass::text FROM outbox_messages_archive`).Scan(&partition))
+	require.NotEqual(t, "outbox_messages_archive_default", partition)
+	require.Regexp(t, `^outbox_messages_archive_\d{4}_\d{2}$`, partition)
+}
+
+// Every month back to the oldest row gets its partition, not only the
+// cutoff's. outboxctl archive once created the cutoff's alone, so older rows
+// went to the default partition — and once that held a month's rows, the
+// month's own partition could never be created.
+func TestIntegrationEnsureArchivePartitions_CoversEveryMonthBackToTheOldestRow(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	completeAll(t, p, 2, 48*time.Hour)
+	_, err := p.Exec(ctx,
+		`UPDATE outbox_messages SET completed_at = now() - interval '100 days'
+		  WHERE message_id = (SELECT message_id FROM outbox_messages ORDER BY seq LIMIT 1)`)
+	require.NoError(t, err)
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, outbox.EnsureArchivePartitions(ctx, p, cutoff))
+	n, err := outbox.ArchiveCompleted(ctx, p, cutoff, 100)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	var inDefault int
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT count(*) FROM outbox_messages_archive_default`).Scan(&inDefault))
+	require.Zero(t, inDefault, "every archived row has its month's partition")
+
+	var months int
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT count(*) FROM pg_inherits
+		  WHERE inhparent = 'outbox_messages_archive'::regclass
+		    AND inhrelid::regclass::text <> 'outbox_messages_archive_default'`).Scan(&months))
+	require.GreaterOrEqual(t, months, 4, "the oldest row's month through the month after the cutoff")
+}
+
+// An archived row keeps what it was enqueued with, not only the columns the
+// archive started out with.
+func TestIntegrationArchiveCompleted_KeepsTheRowsColumns(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+	enqueueKeyed(t, p, "event-1", 1)
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	_, err := p.Exec(ctx, `UPDATE outbox_messages SET traceparent = $1, correlation_id = 'chain-1'`,
+		traceparent)
+	require.NoError(t, err)
+	pub := &fakePublisher{}
+	r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100)
+	_, err = r.ProcessTopQueued(ctx)
+	require.NoError(t, err)
+
+	n, err := outbox.ArchiveCompleted(ctx, p, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	var (
+		key, trace, correlation string
+		version                 int
+	)
+	require.NoError(t, p.QueryRow(ctx,
+		`SELECT partition_key, traceparent, correlation_id, payload_version FROM outbox_messages_archive`).
+		Scan(&key, &trace, &correlation, &version))
+	require.Equal(t, "event-1", key)
+	require.Equal(t, traceparent, trace)
+	require.Equal(t, "chain-1", correlation)
+	require.Equal(t, events.Version(events.EventCreatedName), version)
+}
@@ -0,0 +1,135 @@
+package relay_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/processors"
+	"eventify/outbox/relay"
+	"eventify/platform/logger"
+	"eventify/platform/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// tracePublisher records the traceparent each message would carry: the one in
+// ctx for Publish, the one on the message for PublishBatch.
+type tracePublisher struct {
+	traceparents []string
+	mu           sync.Mutex
+}
+
+func (p *tracePublisher) Publish(ctx context.Context, _, _ string, _ []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.traceparents = append(p.traceparents, telemetry.Traceparent(ctx))
+	return nil
+}
+
+type traceBatchPublisher struct{ tracePublisher }
+
+func (p *traceBatchPublisher) PublishBatch(_ context.Context, msgs []processors.Outgoing) []error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range msgs {
+		p.traceparents = append(p.traceparents, m.Traceparent)
+	}
+	return make([]error, len(msgs))
+}
+
+// enqueueTraced enqueues one message inside a request traced as
+// sampleTraceparent.
+func enqueueTraced(t *testing.T, p *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+	ctx := telemetry.WithTraceparent(context.Background(), sampleTraceparent)
+	messageID := uuid.New()
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, events.EventCreatedName, messageID,
+		events.EventCreated{MessageID: messageID, OccurredAt: time.Now().UTC()}))
+	require.NoError(t, tx.Commit(ctx))
+	return messageID
+}
+
+func TestIntegrationOutbox_EnqueueStoresTheTraceparent(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := context.Background()
+
+	traced := enqueueTraced(t, p)
+	m, err := outbox.Find(ctx, p, traced)
+	require.NoError(t, err)
+	require.Equal(t, sampleTraceparent, m.Traceparent)
+
+	enqueueEvents(t, p, 1)
+	msgs, err := outbox.List(ctx, p, outbox.Filter{})
+	require.NoError(t, err)
+	for _, m := range msgs {
+		if m.MessageID != traced {
+			require.Empty(t, m.Traceparent, "a message enqueued outside a trace carries none")
+		}
+	}
+}
+
+// The trace has to survive both publishing paths, or it ends at the relay for
+// whichever one a deployment happens to take.
+func TestIntegrationRelay_PublishesTheStoredTraceparent(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+
+	for name, pub := range map[string]interface {
+		processors.Publisher
+		sent() []string
+	}{
+		"one at a time": &tracePublisher{},
+		"in a batch":    &traceBatchPublisher{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			enqueueTraced(t, p)
+			r := relay.New(p, eventCreatedProcessors(pub), logger.New(false), time.Hour, 100)
+
+			n, err := r.ProcessTopQueued(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+			require.Equal(t, []string{sampleTraceparent}, pub.sent())
+		})
+	}
+}
+
+func (p *tracePublisher) sent() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.traceparents...)
+}
+
+// A message enqueued while handling another carries the other's correlation
+// ID; one enqueued outside any chain stores none.
+func TestIntegrationOutbox_EnqueueStoresTheCorrelationID(t *testing.T) {
+	skipUnlessDocker(t)
+	p := pool(t)
+	ctx := events.WithCorrelationID(context.Background(), "chain-1")
+
+	messageID := uuid.New()
+	tx, err := p.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Enqueue(ctx, tx, events.EventCreatedName, messageID,
+		events.EventCreated{MessageID: messageID, OccurredAt: time.Now().UTC()}))
+	require.NoError(t, tx.Commit(ctx))
+
+	m, err := outbox.Find(context.Background(), p, messageID)
+	require.NoError(t, err)
+	require.Equal(t, "chain-1", m.CorrelationID)
+
+	unchained := enqueueTraced(t, p)
+	m, err = outbox.Find(context.Background(), p, unchained)
+	require.NoError(t, err)
+	require.Empty(t, m.CorrelationID)
+}
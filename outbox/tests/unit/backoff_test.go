@@ -0,0 +1,46 @@
+package outbox_test
+
+import (
+	"testing"
+	"time"
+
+	"eventify/outbox"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff_DoublesFromBaseUpToMax(t *testing.T) {
+	b := outbox.Backoff{Base: time.Second, Max: 10 * time.Second}
+
+	require.Equal(t, time.Duration(0), b.Delay(0), "nothing has failed yet")
+	require.Equal(t, 1*time.Second, b.Delay(1))
+	require.Equal(t, 2*time.Second, b.Delay(2))
+	require.Equal(t, 4*time.Second, b.Delay(3))
+	require.Equal(t, 8*time.Second, b.Delay(4))
+	require.Equal(t, 10*time.Second, b.Delay(5), "capped at Max")
+	require.Equal(t, 10*time.Second, b.Delay(outbox.MaxAttempts))
+}
+
+// The zero Backoff is the relay's old behaviour: retry on the next poll.
+func TestBackoff_ZeroValueRetriesImmediately(t *testing.T) {
+	var b outbox.Backoff
+	for attempts := range int32(outbox.MaxAttempts) {
+		require.Equal(t, time.Duration(0), b.Delay(attempts))
+	}
+}
+
+// An uncapped backoff must saturate rather than overflow into a negative delay,
+// which would make a failing row claimable again at once.
+func TestBackoff_UncappedDoesNotOverflow(t *testing.T) {
+	b := outbox.Backoff{Base: time.Second}
+	require.Positive(t, b.Delay(200))
+}
+
+func TestBackoff_JitterOnlyShortensTheDelay(t *testing.T) {
+	b := outbox.Backoff{Base: time.Second, Max: time.Minute, Jitter: 0.5}
+	for range 100 {
+		d := b.Delay(3)
+		require.LessOrEqual(t, d, 4*time.Second)
+		require.GreaterOrEqual(t, d, 2*time.Second)
+	}
+}
@@ -0,0 +1,62 @@
+package outbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/outbox"
+	"eventify/outbox/processors"
+	platformamqp "eventify/platform/amqp"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope_DescribesTheRow(t *testing.T) {
+	m := &outbox.Message{
+		MessageID:     uuid.New(),
+		PayloadType:   events.EventCreatedName,
+		OccurredAt:    time.Now().UTC(),
+		Traceparent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		CorrelationID: "chain-1",
+	}
+
+	require.Equal(t, events.Envelope{
+		Name:          events.EventCreatedName,
+		Version:       events.Version(events.EventCreatedName),
+		MessageID:     m.MessageID,
+		OccurredAt:    m.OccurredAt,
+		Producer:      processors.Producer,
+		Traceparent:   m.Traceparent,
+		CorrelationID: "chain-1",
+	}, processors.Envelope(m))
+}
+
+func TestEnvelope_StartsAChainWithItsOwnMessageID(t *testing.T) {
+	m := &outbox.Message{MessageID: uuid.New(), PayloadType: events.EventCreatedName}
+	require.Equal(t, m.MessageID.String(), processors.Envelope(m).CorrelationID)
+}
+
+// Both publishing paths send the envelope: the batch on each Outgoing, the
+// single publish through ctx.
+func TestGeneric_SendsTheEnvelopeAsHeaders(t *testing.T) {
+	m := &outbox.Message{MessageID: uuid.New(), PayloadType: events.EventCreatedName}
+	want := processors.Envelope(m).Headers()
+
+	pub := &headerPublisher{}
+	g := processors.NewGeneric(pub, events.EventCreatedName)
+	require.Equal(t, want, g.Outgoing(m).Headers)
+
+	require.NoError(t, g.ProcessAsync(context.Background(), m))
+	require.Equal(t, want, pub.headers)
+}
+
+// headerPublisher records the headers Publish was asked to send.
+type headerPublisher struct{ headers map[string]string }
+
+func (p *headerPublisher) Publish(ctx context.Context, _, _ string, _ []byte) error {
+	p.headers = platformamqp.HeadersFrom(ctx)
+	return nil
+}
@@ -0,0 +1,29 @@
+package outbox_test
+
+import (
+	"testing"
+
+	"eventify/outbox"
+	"eventify/outbox/relay"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByPartitionKey_KeysOnThePartitionKey(t *testing.T) {
+	a := &outbox.Message{MessageID: uuid.New(), PartitionKey: "event-1"}
+	b := &outbox.Message{MessageID: uuid.New(), PartitionKey: "event-1"}
+	require.Equal(t, relay.ByPartitionKey(a), relay.ByPartitionKey(b))
+	require.NotEqual(t, relay.ByPartitionKey(a), relay.ByPartitionKey(&outbox.Message{PartitionKey: "event-2"}))
+}
+
+// A message enqueued without a key promised no order, so it shares a
+// partition with nothing — not with other unkeyed messages, and not with a
+// key that happens to spell its message ID.
+func TestByPartitionKey_UnkeyedMessagesArePartitionsOfTheirOwn(t *testing.T) {
+	a := &outbox.Message{MessageID: uuid.New()}
+	b := &outbox.Message{MessageID: uuid.New()}
+	require.NotEqual(t, relay.ByPartitionKey(a), relay.ByPartitionKey(b))
+	require.NotEqual(t, relay.ByPartitionKey(a),
+		relay.ByPartitionKey(&outbox.Message{PartitionKey: a.MessageID.String()}))
+}
@@ -0,0 +1,26 @@
+package outbox_test
+
+import (
+	"testing"
+
+	"eventify/outbox"
+
+	"github.com/stretchr/testify/require"
+)
+
+// outboxctl takes statuses by name, so every status must survive the round
+// trip through its String form.
+func TestParseStatus_RoundTripsEveryStatus(t *testing.T) {
+	for _, s := range []outbox.Status{outbox.Queued, outbox.Poisoned, outbox.Completed, outbox.Exceeded} {
+		got, err := outbox.ParseStatus(s.String())
+		require.NoError(t, err)
+		require.Equal(t, s, got)
+	}
+
+	got, err := outbox.ParseStatus("exceeded")
+	require.NoError(t, err, "case does not matter")
+	require.Equal(t, outbox.Exceeded, got)
+
+	_, err = outbox.ParseStatus("PUBLISHED")
+	require.Error(t, err)
+}
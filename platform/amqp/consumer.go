@@ -0,0 +1,477 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"eventify/platform/logger"
+	"eventify/platform/telemetry"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RoutingKeyHeader carries the routing key a message was first published
+// under. A message coming back from a delay queue arrives with the group's
+// queue name as its routing key, so the consumer stamps the original here
+// before the first retry, and reads it back on every later delivery.
+const RoutingKeyHeader = "x-eventify-routing-key"
+
+// ErrorHeader carries the handler error behind a message's latest retry or its
+// parking, so whoever finds it in the parking queue can see why it is there.
+// The broker's x-death header records where a message has been, never why.
+const ErrorHeader = "x-eventify-error"
+
+// DeliveriesHeader carries how many times a message had been delivered to its
+// group when the consumer last sent it to a delay queue; see Deliveries.
+const DeliveriesHeader = "x-eventify-deliveries"
+
+// maxErrorHeader caps ErrorHeader, so one pathological error cannot bloat
+// every copy of a message.
+const maxErrorHeader = 1024
+
+// maxRedial caps the wait between attempts to reconnect a dropped consumer.
+const maxRedial = 30 * time.Second
+
+const (
+	// DefaultPrefetch is how many unacked messages the broker hands a
+	// consumer ahead of its handlers when WithPrefetch is not given.
+	DefaultPrefetch = 16
+	// DefaultShutdownTimeout is how long Run waits, once its context is
+	// cancelled, for in-flight handlers to finish.
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+// Delivery is one message handed to a consumer's handler.
+type Delivery struct {
+	Headers    amqp.Table
+	RoutingKey string
+	MessageID  string
+	Body       []byte
+	// Deliveries counts this delivery and every earlier one; see Deliveries.
+	Deliveries int
+}
+
+// HandlerFunc handles one delivery. A nil error acks it; any other sends it
+// down the group's RetryPolicy, and travels with the message in ErrorHeader.
+type HandlerFunc func(ctx context.Context, d Delivery) error
+
+// Consumer consumes one consumer group's queue, retrying failed messages
+// through delay queues and parking the ones that never succeed.
+//
+// It was a watermill subscriber. watermill's nack always requeues, which is
+// the hot loop this topology exists to end, and it refuses to decode a message
+// whose headers are not all strings — which every dead-lettered message's
+// x-death header is not.
+type Consumer struct {
+	log    *logger.Logger
+	uri    string
+	group  string
+	keys   []string
+	policy RetryPolicy
+
+	workers         int
+	pools           map[string]int
+	poolOf          func(Delivery) string
+	prefetch        int
+	shutdownTimeout time.Duration
+
+	// connected is true while a connection is up and consuming.
+	connected atomic.Bool
+}
+
+// ConsumerOption configures a Consumer.
+type ConsumerOption func(*Consumer)
+
+// WithWorkers handles up to n deliveries at once, each on its own goroutine.
+// Without it a Consumer handles one at a time. With WithPools, n is the size of
+// the pool every delivery no other pool claims shares.
+//
+// The relay publishes each partition key's messages in order, and one worker
+// handles them in that order. More than one can apply two events for the same
+// key out of order, so only raise it for handlers that do not care.
+func WithWorkers(n int) ConsumerOption {
+	return func(c *Consumer) { c.workers = max(n, 1) }
+}
+
+// WithPools gives deliveries workers of their own by name. poolOf names the
+// pool a delivery belongs to, and workers sizes each pool; a delivery whose
+// pool is not in workers, or is sized below 1, goes to the pool WithWorkers
+// sizes.
+//
+// A pool is what keeps one slow kind of message from taking every worker: its
+// deliveries wait for its own workers, while the others' go on being handled.
+// One worker in a pool handles that pool's deliveries in the order they came,
+// but nothing orders them against another pool's: two messages the relay
+// published in order, for one partition key, are handled in either order if
+// they belong to different pools.
+func WithPools(poolOf func(Delivery) string, workers map[string]int) ConsumerOption {
+	return func(c *Consumer) {
+		c.poolOf = poolOf
+		c.pools = make(map[string]int, len(workers))
+		for name, n := range workers {
+			if n >= 1 {
+				c.pools[name] = n
+			}
+		}
+	}
+}
+
+// WithPrefetch sets the channel's QoS: how many unacked deliveries the broker
+// sends ahead. It is raised to the number of workers, every pool's counted, if
+// lower, or workers would sit idle with messages waiting in the queue. A
+// non-positive n takes DefaultPrefetch.
+//
+// Every prefetched message is redelivered if the consumer dies, and none of
+// them can go to another replica meanwhile, so a high prefetch trades fairness
+// between replicas for fewer round trips.
+func WithPrefetch(n int) ConsumerOption {
+	if n <= 0 {
+		n = DefaultPrefetch
+	}
+	return func(c *Consumer) { c.prefetch = n }
+}
+
+// WithShutdownTimeout bounds how long Run waits for in-flight handlers once
+// its context is cancelled. A handler still running after d has its context
+// cancelled, and its message goes back on the queue. A non-positive d takes
+// DefaultShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) ConsumerOption {
+	if d <= 0 {
+		d = DefaultShutdownTimeout
+	}
+	return func(c *Consumer) { c.shutdownTimeout = d }
+}
+
+// NewConsumer builds a Consumer for group's queue, bound to keys. Nothing is
+// dialled until Run.
+func NewConsumer(uri, group string, keys []string, policy RetryPolicy, log *logger.Logger,
+	opts ...ConsumerOption) *Consumer {
+
+	c := &Consumer{
+		uri: uri, group: group, keys: keys, policy: policy, log: log,
+		workers:         1,
+		prefetch:        DefaultPrefetch,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	workers := c.workers
+	for _, n := range c.pools {
+		workers += n
+	}
+	c.prefetch = max(c.prefetch, workers)
+	return c
+}
+
+// Run consumes until ctx is cancelled, redialling with a capped exponential
+// delay whenever the connection drops. Messages in flight when it drops are
+// redelivered by the broker.
+//
+// Cancelling ctx shuts down gracefully: the broker stops sending, prefetched
+// messages no handler has started are handed back, and Run returns only once
+// every handler already running has finished and its message has been acked,
+// retried or parked — or once the shutdown timeout has passed.
+func (c *Consumer) Run(ctx context.Context, handle HandlerFunc) error {
+	delay := time.Second
+	for {
+		established, err := c.consume(ctx, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if established {
+			delay = time.Second
+		}
+		c.log.ErrorWithError("amqp consumer for "+c.group+" dropped, redialling in "+delay.String(), err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRedial)
+	}
+}
+
+// Connected reports whether the consumer has a connection up and is consuming
+// on it. It is false before Run, and while Run is redialling.
+func (c *Consumer) Connected() bool {
+	return c.connected.Load()
+}
+
+// consume runs one connection until it fails or ctx is cancelled. It reports
+// whether it got as far as consuming, so Run knows whether to reset its delay.
+func (c *Consumer) consume(ctx context.Context, handle HandlerFunc) (bool, error) {
+	conn, err := amqp.Dial(c.uri)
+	if err != nil {
+		return false, fmt.Errorf("dial amqp: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("open amqp channel: %w", err)
+	}
+	if err := DeclareConsumerGroup(ch, c.group, c.keys, c.policy); err != nil {
+		return false, err
+	}
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
+		return false, fmt.Errorf("set prefetch: %w", err)
+	}
+	// Retries are republished on this channel, and must be confirmed before
+	// the delivery they replace is acked.
+	if err := ch.Confirm(false); err != nil {
+		return false, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	// A consumer tag only has to be unique on its channel.
+	const tag = "eventify"
+	msgs, err := ch.Consume(c.group, tag, false, false, false, false, nil)
+	if err != nil {
+		return false, fmt.Errorf("consume %s: %w", c.group, err)
+	}
+	c.connected.Store(true)
+	defer c.connected.Store(false)
+
+	// Handlers run on a context of their own, so cancelling ctx stops the
+	// consumer without also failing every message a handler is halfway
+	// through. It is cancelled only if they overrun the shutdown timeout.
+	hctx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		failed  error
+	)
+	// Each pool has a queue its workers drain. A queue holds the prefetch
+	// count, as many deliveries as the broker ever leaves unacked, so handing
+	// one to a busy pool never holds up the deliveries behind it.
+	start := func(workers int) chan job {
+		jobs := make(chan job, c.prefetch)
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range jobs {
+					if ctx.Err() != nil {
+						// Prefetched, but shutdown began before any handler
+						// started on it. Hand it straight back.
+						_ = j.raw.Nack(false, true)
+						continue
+					}
+					if err := c.settle(hctx, ch, j.raw, j.delivery, handle); err != nil {
+						errOnce.Do(func() { failed = err })
+					}
+				}
+			}()
+		}
+		return jobs
+	}
+	shared := start(c.workers)
+	pools := make(map[string]chan job, len(c.pools))
+	for name, n := range c.pools {
+		pools[name] = start(n)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			close(shared)
+			for _, jobs := range pools {
+				close(jobs)
+			}
+		}()
+		// msgs closes when the consumer is cancelled or the channel dies; it
+		// is read to the end either way, so no delivery is left unread for
+		// the library to block on.
+		for d := range msgs {
+			delivery := c.delivery(d)
+			jobs := shared
+			if p, ok := pools[c.pool(delivery)]; ok {
+				jobs = p
+			}
+			jobs <- job{raw: d, delivery: delivery}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if failed != nil {
+			return true, failed
+		}
+		return true, fmt.Errorf("consume %s: delivery channel closed", c.group)
+	case <-ctx.Done():
+	}
+
+	if err := ch.Cancel(tag, false); err != nil {
+		// The channel is gone, so msgs is closing anyway, and the broker
+		// requeues whatever was unacked.
+		c.log.ErrorWithError("cancel amqp consumer for "+c.group, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(c.shutdownTimeout):
+		c.log.Error("amqp consumer for " + c.group + ": handlers overran the shutdown timeout, cancelling them")
+		cancelHandlers()
+		<-done
+	}
+	return true, ctx.Err()
+}
+
+// job is one delivery on its way to a pool's workers.
+type job struct {
+	raw      amqp.Delivery
+	delivery Delivery
+}
+
+// delivery is what the handler is told about d.
+func (c *Consumer) delivery(d amqp.Delivery) Delivery {
+	return Delivery{
+		Headers:    d.Headers,
+		RoutingKey: OriginalRoutingKey(d.Headers, d.RoutingKey),
+		MessageID:  d.MessageId,
+		Body:       d.Body,
+		Deliveries: Deliveries(d.Headers, c.group),
+	}
+}
+
+// pool names the pool d belongs to; "" without WithPools.
+func (c *Consumer) pool(d Delivery) string {
+	if c.poolOf == nil {
+		return ""
+	}
+	return c.poolOf(d)
+}
+
+// settle hands delivery, the handler's view of d, to handle and acks, retries
+// or parks d by the outcome. An error means the channel can no longer be
+// trusted.
+func (c *Consumer) settle(ctx context.Context, ch *amqp.Channel, d amqp.Delivery, delivery Delivery, handle HandlerFunc) error {
+	routingKey := delivery.RoutingKey
+
+	// The message's traceparent, if the producer's relay sent one, makes this
+	// span a child of the request that produced the event.
+	tp, _ := d.Headers[telemetry.TraceparentHeader].(string)
+	hctx, end := telemetry.StartSpan(telemetry.WithTraceparent(ctx, tp), "consume "+routingKey, map[string]string{
+		"messaging.system":               "rabbitmq",
+		"messaging.destination.name":     c.group,
+		"messaging.message.id":           delivery.MessageID,
+		"messaging.rabbitmq.routing_key": routingKey,
+	})
+	herr := handle(hctx, delivery)
+	end(herr)
+	if herr == nil {
+		return d.Ack(false)
+	}
+	if ctx.Err() != nil {
+		// Shutdown cut the handler off; the message did nothing to earn a
+		// retry, and this one could be its last. Put it back as it was.
+		return d.Nack(false, true)
+	}
+
+	log := c.log.WithFields(logger.Fields{
+		"message_id":  delivery.MessageID,
+		"routing_key": routingKey,
+		"deliveries":  delivery.Deliveries,
+	})
+
+	delay, park := c.policy.Delay(delivery.Deliveries)
+	if park {
+		parked := ParkingQueueName(c.group)
+		if err := c.republish(ctx, ch, d, DeadLetterExchange, parked, routingKey, delivery.Deliveries, herr); err != nil {
+			// Rejecting still parks it, through the queue's own dead-letter
+			// arguments, only without the error that put it there.
+			log.ErrorWithError("park message in "+parked+" with its error", err)
+			return d.Reject(false)
+		}
+		log.ErrorWithError("parked message in "+parked, herr)
+		return d.Ack(false)
+	}
+
+	if err := c.republish(ctx, ch, d, RetryExchange, RetryQueueName(c.group, delay), routingKey, delivery.Deliveries, herr); err != nil {
+		// The retry was not confirmed, so the original must not be dropped.
+		// Requeueing it is the old hot loop, but only until the broker
+		// accepts a publish again.
+		log.ErrorWithError("schedule retry", err)
+		return d.Nack(false, true)
+	}
+	log.ErrorWithError("retrying in "+delay.String(), herr)
+	return d.Ack(false)
+}
+
+// republish copies d to exchange under key, stamped with its original routing
+// key, the deliveries it has had and the handler error, and waits for the
+// broker to confirm it.
+func (c *Consumer) republish(ctx context.Context, ch *amqp.Channel, d amqp.Delivery,
+	exchange, key, routingKey string, deliveries int, herr error) error {
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[RoutingKeyHeader] = routingKey
+	headers[DeliveriesHeader] = int64(deliveries)
+	msg := herr.Error()
+	if len(msg) > maxErrorHeader {
+		msg = msg[:maxErrorHeader]
+	}
+	headers[ErrorHeader] = msg
+
+	ctx, cancel := context.WithTimeout(ctx, ConfirmTimeout)
+	defer cancel()
+
+	// Mandatory is left off: the queues behind both exchanges were declared
+	// with the group's own, so a message can only go unrouted if someone
+	// deleted one by hand.
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("publish to %s: %w", key, err)
+	}
+	ok, err := dc.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("confirm %s: %w", key, err)
+	}
+	if !ok {
+		return fmt.Errorf("confirm %s: %w", key, ErrNacked)
+	}
+	return nil
+}
+
+// OriginalRoutingKey is the routing key a message carrying headers was first
+// published under. routingKey is the one it arrived with, which is the answer
+// only for a message that has never been retried or parked.
+//
+// A message the consumer has retried or parked carries RoutingKeyHeader. One
+// the broker dead-lettered on its own, because republishing it failed, carries
+// only x-death, whose newest entry lists the keys it was published with.
+func OriginalRoutingKey(headers amqp.Table, routingKey string) string {
+	if k, ok := headers[RoutingKeyHeader].(string); ok && k != "" {
+		return k
+	}
+	deaths, _ := headers["x-death"].([]any)
+	if len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			if keys, _ := death["routing-keys"].([]any); len(keys) > 0 {
+				if k, ok := keys[0].(string); ok && k != "" {
+					return k
+				}
+			}
+		}
+	}
+	return routingKey
+}
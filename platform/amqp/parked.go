@@ -0,0 +1,76 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Parked is one message taken, unacknowledged, off a parking queue. Ack takes
+// it off for good; anything else leaves it to go back when WalkParked returns.
+type Parked struct {
+	amqp.Delivery
+	// RoutingKey is the key the message was first published with, not the
+	// parking queue's; see OriginalRoutingKey.
+	RoutingKey string
+}
+
+// Failure is the handler error that parked the message, from ErrorHeader.
+func (p Parked) Failure() string {
+	s, _ := p.Headers[ErrorHeader].(string)
+	return s
+}
+
+// WalkParked takes the messages parked for group one at a time and hands each
+// to fn, stopping after limit of them (0 for no limit), when the queue runs
+// dry, or when fn fails.
+//
+// It stops, too, at the number of messages the queue held when it started. A
+// replayed message that fails again can be parked again during the walk, and
+// must not be met a second time.
+//
+// A queue cannot be read without taking messages off it. Every message fn does
+// not ack goes back on the queue when WalkParked returns, in the same place
+// but marked redelivered.
+func WalkParked(ctx context.Context, uri, group string, limit int, fn func(Parked) error) error {
+	conn, err := amqp.Dial(uri)
+	if err != nil {
+		return fmt.Errorf("dial amqp: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open amqp channel: %w", err)
+	}
+	// Closing the channel is what requeues every message left unacked.
+	defer func() { _ = ch.Close() }()
+
+	queue := ParkingQueueName(group)
+	q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", queue, err)
+	}
+	n := q.Messages
+	if limit > 0 {
+		n = min(n, limit)
+	}
+
+	for range n {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return fmt.Errorf("get from %s: %w", queue, err)
+		}
+		if !ok {
+			return nil
+		}
+		if err := fn(Parked{Delivery: d, RoutingKey: OriginalRoutingKey(d.Headers, d.RoutingKey)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,49 +2,416 @@ package amqp
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
+
+	"eventify/platform/telemetry"
 
-	"github.com/ThreeDotsLabs/watermill"
 	wamqp "github.com/ThreeDotsLabs/watermill-amqp/v2/pkg/amqp"
-	"github.com/ThreeDotsLabs/watermill/message"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConfirmTimeout bounds how long Publish waits for the broker to confirm a
+// message when the caller's context sets no earlier deadline.
+const ConfirmTimeout = 30 * time.Second
+
+var (
+	// ErrUnroutable is returned for a message the broker accepted but could
+	// not route to any queue: nothing is bound to its routing key. The broker
+	// has dropped it. Publishing it again will only succeed once a queue is
+	// bound, so it says nothing about the health of the broker or of the
+	// messages published beside it.
+	ErrUnroutable = errors.New("amqp message unroutable")
+	// ErrNacked is returned for a message the broker refused to take
+	// responsibility for, typically because it is out of resources.
+	ErrNacked = errors.New("amqp message nacked by broker")
+	// ErrClosed is returned for a message whose channel closed before the
+	// broker confirmed it. It may or may not have been routed.
+	ErrClosed = errors.New("amqp channel closed before confirm")
 )
 
-// Publisher sends event payloads to the shared durable topic exchange.
+// Publisher sends event payloads to the shared durable topic exchange, and
+// returns only once the broker has confirmed each one.
 //
 // It lives beside the topology it publishes into, rather than in the outbox
 // module that happens to be its only caller today. Dialing a broker is
 // infrastructure, not a property of the outbox pattern: a second publisher —
 // say, one that republishes from a dead-letter queue — would otherwise have to
 // import outbox to reach it.
+//
+// It used to be a watermill publisher, which returned as soon as the message
+// was written to the socket. A message the broker then dropped — no queue
+// bound to its key, or a crash before it was persisted — was still reported as
+// sent, and the relay marked its row COMPLETED. The channel is now in confirm
+// mode and every message is published mandatory, so Publish returns nil only
+// once the broker has routed the message to at least one queue and taken
+// responsibility for it. watermill has no way to report a mandatory message
+// coming back, so the channel is driven with amqp091 directly.
+//
+// A Publisher is safe for concurrent use. It dials lazily and redials after the
+// connection drops.
 type Publisher struct {
-	pub message.Publisher
+	uri string
+
+	// pubMu serialises publishes, so the delivery tag read before a publish is
+	// the one the broker assigns it. mu guards sess; it is never held while
+	// publishing, because the goroutine reading confirms needs the session and
+	// the library blocks publishes while that goroutine is busy.
+	pubMu sync.Mutex
+	mu    sync.Mutex
+	sess  *session
 }
 
-// NewPublisher dials amqpURI using the shared topology.
+// NewPublisher dials amqpURI and declares the shared topology.
 func NewPublisher(amqpURI string) (*Publisher, error) {
-	pub, err := wamqp.NewPublisher(
-		PublisherConfig(amqpURI),
-		watermill.NewStdLogger(false, false),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("create amqp publisher: %w", err)
+	p := &Publisher{uri: amqpURI}
+	if _, err := p.session(); err != nil {
+		return nil, err
 	}
-	return &Publisher{pub: pub}, nil
+	return p, nil
 }
 
-// Publish sends body under routingKey.
+// Publish sends body under routingKey and waits for the broker's confirm.
+//
+// It returns an error wrapping ErrUnroutable if no queue is bound to
+// routingKey, ErrNacked if the broker refused the message, and ErrClosed if the
+// connection dropped before either answer arrived. A cancelled ctx also ends
+// the wait; the message may still have been routed.
 //
 // messageID doubles as the watermill UUID, so a consumer can deduplicate from
 // broker metadata without unmarshalling the payload. The payload carries the
 // same value, and that is the copy a consumer should trust: it survives a
 // bridge, a replay from a dump, or any hop that does not preserve metadata.
-func (p *Publisher) Publish(_ context.Context, routingKey, messageID string, body []byte) error {
-	msg := message.NewMessage(messageID, body)
-	if err := p.pub.Publish(routingKey, msg); err != nil {
-		return fmt.Errorf("publish %s: %w", routingKey, err)
+//
+// The span in ctx, if any, is sent as the message's traceparent header, and
+// the headers WithHeaders stored in ctx are sent beside it.
+func (p *Publisher) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	return p.PublishBatch(ctx, []Outgoing{{
+		RoutingKey:  routingKey,
+		MessageID:   messageID,
+		Body:        body,
+		Traceparent: telemetry.Traceparent(ctx),
+		Headers:     HeadersFrom(ctx),
+	}})[0]
+}
+
+type headersKey struct{}
+
+// WithHeaders returns ctx carrying headers for Publish to send with its
+// message. It is how a caller behind an interface that takes no headers — a
+// processor's Publisher — still sends an envelope, the way the traceparent
+// rides ctx.
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// HeadersFrom returns the headers WithHeaders stored in ctx, or nil.
+func HeadersFrom(ctx context.Context) map[string]string {
+	h, _ := ctx.Value(headersKey{}).(map[string]string)
+	return h
+}
+
+// Outgoing is one message handed to PublishBatch.
+type Outgoing struct {
+	RoutingKey string
+	MessageID  string
+	Body       []byte
+	// Traceparent, if set, is sent as the W3C traceparent header, so the
+	// consumer's span joins the trace the message was produced in. A batch
+	// mixes messages from many traces, so each carries its own rather than
+	// taking one from ctx.
+	Traceparent string
+	// Headers are sent as AMQP headers beside the ones the publisher sets
+	// itself, which take precedence.
+	Headers map[string]string
+}
+
+// PublishBatch publishes msgs in order and returns one result per message, at
+// the same index, each meaning what Publish's error would.
+//
+// The confirms are pipelined: every message is written before any confirm is
+// awaited, so a batch costs about one broker round trip rather than one per
+// message. Messages are written on one channel, so they reach each queue in
+// slice order. If a write fails, the messages after it are not attempted and
+// report the same error.
+func (p *Publisher) PublishBatch(ctx context.Context, msgs []Outgoing) []error {
+	ctx, cancel := context.WithTimeout(ctx, ConfirmTimeout)
+	defer cancel()
+
+	results := make([]error, len(msgs))
+	dones := make([]<-chan error, len(msgs))
+	for i, m := range msgs {
+		done, err := p.send(ctx, m)
+		if err != nil {
+			for j := i; j < len(msgs); j++ {
+				results[j] = fmt.Errorf("publish %s: %w", msgs[j].RoutingKey, err)
+			}
+			break
+		}
+		dones[i] = done
+	}
+
+	for i, done := range dones {
+		if done == nil {
+			continue
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				results[i] = fmt.Errorf("publish %s: %w", msgs[i].RoutingKey, err)
+			}
+		case <-ctx.Done():
+			results[i] = fmt.Errorf("publish %s: waiting for confirm: %w", msgs[i].RoutingKey, ctx.Err())
+		}
+	}
+	return results
+}
+
+// send writes one message and returns the channel its confirm will arrive on.
+func (p *Publisher) send(ctx context.Context, m Outgoing) (<-chan error, error) {
+	p.pubMu.Lock()
+	defer p.pubMu.Unlock()
+
+	s, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(amqp.Table, len(m.Headers)+2)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	// Read by the watermill subscriber as the message UUID.
+	headers[wamqp.DefaultMessageUUIDHeaderKey] = m.MessageID
+	if m.Traceparent != "" {
+		headers[telemetry.TraceparentHeader] = m.Traceparent
+	}
+
+	tag := s.ch.GetNextPublishSeqNo()
+	done := s.expect(tag, m.MessageID)
+	err = s.ch.PublishWithContext(ctx, ExchangeName, m.RoutingKey, true, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    m.MessageID,
+		Body:         m.Body,
+	})
+	if err != nil {
+		s.forget(tag)
+		// A failed write leaves the channel in an unknown state. Drop it, so
+		// the next publish starts from a fresh one.
+		_ = s.ch.Close()
+		return nil, err
+	}
+	return done, nil
+}
+
+// session returns the live session, dialling a new one if there is none or
+// the last one closed.
+func (p *Publisher) session() (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sess != nil && !p.sess.ch.IsClosed() {
+		return p.sess, nil
+	}
+	if p.sess != nil {
+		_ = p.sess.conn.Close()
+		p.sess = nil
+	}
+
+	s, err := dial(p.uri)
+	if err != nil {
+		return nil, err
+	}
+	p.sess = s
+	return s, nil
+}
+
+// Ping reports whether the publisher has a connection to the broker, dialling
+// one if the last has dropped, so that a publisher with nothing to send does
+// not report a dead connection forever. ctx is not used: dialling is bounded
+// by the library's own timeout.
+func (p *Publisher) Ping(context.Context) error {
+	_, err := p.session()
+	return err
+}
+
+// Close releases the AMQP connection. Messages still awaiting a confirm fail
+// with ErrClosed.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sess == nil {
+		return nil
+	}
+	err := p.sess.conn.Close()
+	p.sess = nil
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// session is one connection and its confirm-mode channel, with the messages
+// published on it that the broker has not yet confirmed.
+type session struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+
+	mu      sync.Mutex
+	pending map[uint64]*unconfirmed
+	err     error // set once the channel has closed
+}
+
+// unconfirmed is one message awaiting its confirm.
+type unconfirmed struct {
+	messageID string
+	returned  *amqp.Return
+	done      chan error
+}
+
+// dial opens a connection and a confirm-mode channel and declares the exchange.
+func dial(uri string) (*session, error) {
+	conn, err := amqp.Dial(uri)
+	if err != nil {
+		return nil, fmt.Errorf("dial amqp: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("open amqp channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
 	}
-	return nil
+	if err := declareExchange(ch); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	s := &session{conn: conn, ch: ch, pending: map[uint64]*unconfirmed{}}
+
+	// Both listeners are unbuffered, and one goroutine reads both. The library
+	// delivers a message's basic.return before its basic.ack and blocks on
+	// each send, so a return has always been recorded by the time the ack it
+	// belongs to is read. With buffers, or a goroutine each, the ack could win
+	// and an unroutable message would be reported as sent.
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	closes := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go s.watch(returns, confirms, closes)
+	return s, nil
 }
 
-// Close releases the AMQP connection.
-func (p *Publisher) Close() error { return p.pub.Close() }
+// expect registers a message about to be published under tag.
+func (s *session) expect(tag uint64, messageID string) <-chan error {
+	u := &unconfirmed{messageID: messageID, done: make(chan error, 1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		u.done <- s.err
+		return u.done
+	}
+	s.pending[tag] = u
+	return u.done
+}
+
+// forget drops a message whose publish never reached the socket.
+func (s *session) forget(tag uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, tag)
+}
+
+// watch settles every pending message from the broker's returns and confirms,
+// and fails whatever is left when the channel closes.
+func (s *session) watch(returns <-chan amqp.Return, confirms <-chan amqp.Confirmation, closes <-chan *amqp.Error) {
+	defer func() {
+		// Keep the library from blocking on a listener nobody reads.
+		go func() {
+			for range returns {
+			}
+		}()
+		go func() {
+			for range confirms {
+			}
+		}()
+	}()
+
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			s.returned(r)
+		case c, ok := <-confirms:
+			if !ok {
+				s.close(nil)
+				return
+			}
+			s.confirmed(c)
+		case err := <-closes:
+			s.close(err)
+			return
+		}
+	}
+}
+
+// returned marks the oldest pending message with r's ID as unroutable. Its
+// confirm follows.
+func (s *session) returned(r amqp.Return) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest uint64
+	for tag, u := range s.pending {
+		if u.messageID == r.MessageId && u.returned == nil && (oldest == 0 || tag < oldest) {
+			oldest = tag
+		}
+	}
+	if oldest != 0 {
+		s.pending[oldest].returned = &r
+	}
+}
+
+// confirmed settles the message c is for.
+func (s *session) confirmed(c amqp.Confirmation) {
+	s.mu.Lock()
+	u, ok := s.pending[c.DeliveryTag]
+	delete(s.pending, c.DeliveryTag)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch {
+	case !c.Ack:
+		u.done <- ErrNacked
+	case u.returned != nil:
+		u.done <- fmt.Errorf("%w: %s (%d)", ErrUnroutable, u.returned.ReplyText, u.returned.ReplyCode)
+	default:
+		u.done <- nil
+	}
+}
+
+// close fails every pending message and every later expect.
+func (s *session) close(cause *amqp.Error) {
+	err := ErrClosed
+	if cause != nil {
+		err = fmt.Errorf("%w: %s", ErrClosed, cause.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	for tag, u := range s.pending {
+		u.done <- err
+		delete(s.pending, tag)
+	}
+}
@@ -1,65 +1,219 @@
 // Package amqp defines the eventify AMQP topology in exactly one place.
 //
-// Both the outbox relay (publisher) and the subscribers (consumer) build their
-// watermill config from here. They must agree on the exchange name, the
+// Both the outbox relay (publisher) and the subscribers (consumer) take their
+// exchanges and queues from here. They must agree on the exchange name, the
 // exchange type, and how a topic maps to a routing key — and nothing in the
-// type system forces them to. Sharing the constructors is what forces it.
+// type system forces them to. Sharing the declarations is what forces it.
 //
-// The topology is a single durable topic exchange:
+// The topology is a single durable topic exchange, plus a retry path per
+// consumer group:
 //
 //	exchange "eventify" (topic, durable)
-//	  ├── routing key eventify.events.EventCreated.v1   ─┐
-//	  └── routing key eventify.events.EventCancelled.v1 ─┴─► queue "eventify.analytics"
+//	  ├── routing key eventify.events.EventCreated   ─┐
+//	  └── routing key eventify.events.EventCancelled ─┴─► queue "eventify.analytics"
+//
+//	queue "eventify.analytics"
+//	  ├── handler fails, deliveries left ─► exchange "eventify.retry" (direct)
+//	  │                                       └─► queue "eventify.analytics.retry.5s"  (TTL 5s)
+//	  │                                       └─► queue "eventify.analytics.retry.30s" (TTL 30s)
+//	  │                                       └─► ... each dead-letters back to "eventify.analytics"
+//	  └── handler fails, deliveries spent ─► exchange "eventify.dlx" (direct)
+//	                                          └─► queue "eventify.analytics.parked"
 //
 // One exchange, one queue per consumer group, N bindings. Adding an event adds
 // a binding, not a queue and not a binary.
 //
-// Note that watermill's NewDurablePubSubConfig defaults to a *fanout* exchange
-// named after the topic, with empty routing keys. That default gives one
-// exchange per event type and makes routing keys inert, so every constructor
-// below overrides it.
+// A failed message used to be nacked and requeued at the head of its queue, so
+// a message that could never succeed was redelivered in a hot loop, forever,
+// ahead of everything behind it. It now waits out a delay tier outside the
+// queue, and after RetryPolicy.MaxDeliveries it is parked where an operator can
+// inspect and replay it (see subscribers/cmd/dlq).
+//
+// RabbitMQ refuses to redeclare a queue with different arguments. A group
+// queue declared before the dead-letter arguments existed has none, so it must
+// be drained and deleted once before a consumer that declares them can start.
 package amqp
 
 import (
-	wamqp "github.com/ThreeDotsLabs/watermill-amqp/v2/pkg/amqp"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// ExchangeName is the single durable topic exchange all eventify events flow
-// through.
-const ExchangeName = "eventify"
+const (
+	// ExchangeName is the single durable topic exchange all eventify events
+	// flow through.
+	ExchangeName = "eventify"
+	// RetryExchange routes a failed message to its group's delay queue for the
+	// tier it has reached. It is direct: the consumer names the queue.
+	RetryExchange = "eventify.retry"
+	// DeadLetterExchange receives every message a consumer group parks, and
+	// routes it to that group's parking queue.
+	DeadLetterExchange = "eventify.dlx"
+)
 
-// identity is used wherever watermill hands us a topic that is already the
-// fully-qualified routing key (see events.RoutingKey).
-func identity(topic string) string { return topic }
+// RetryPolicy decides what happens to a message whose handler failed.
+//
+// A message failing for the nth time waits Delays[n-1] — the last tier once
+// n runs past them — and is then delivered again. A message that has been
+// delivered MaxDeliveries times is parked instead.
+type RetryPolicy struct {
+	Delays        []time.Duration
+	MaxDeliveries int
+}
 
-func constant(name string) func(string) string {
-	return func(string) string { return name }
+// DefaultRetryPolicy rides out a dependency restart in its first tiers and
+// gives up after about six minutes.
+var DefaultRetryPolicy = RetryPolicy{
+	Delays:        []time.Duration{5 * time.Second, 30 * time.Second, 5 * time.Minute},
+	MaxDeliveries: 5,
 }
 
-// PublisherConfig builds a config that publishes to the topic exchange, using
-// the topic argument as the routing key verbatim.
-func PublisherConfig(amqpURI string) wamqp.Config {
-	cfg := wamqp.NewDurablePubSubConfig(amqpURI, nil)
-	cfg.Exchange.GenerateName = constant(ExchangeName)
-	cfg.Exchange.Type = "topic"
-	cfg.Exchange.Durable = true
-	cfg.Publish.GenerateRoutingKey = identity
-	return cfg
+// Delay is how long a message that has failed deliveries times waits before it
+// is delivered again, and whether it should be parked instead.
+func (p RetryPolicy) Delay(deliveries int) (time.Duration, bool) {
+	if deliveries >= p.MaxDeliveries || len(p.Delays) == 0 {
+		return 0, true
+	}
+	return p.Delays[min(max(deliveries, 1), len(p.Delays))-1], false
 }
 
-// SubscriberConfig builds a config that binds one durable queue to the topic
-// exchange, once per routing key subscribed to.
+// RetryQueueName is the delay queue for one tier of group, e.g.
+// "eventify.analytics.retry.30s".
+func RetryQueueName(group string, delay time.Duration) string {
+	return group + ".retry." + delay.String()
+}
+
+// ParkingQueueName is where group's exhausted messages wait for an operator.
+func ParkingQueueName(group string) string { return group + ".parked" }
+
+// declareExchange declares the topic exchange on ch. A declaration that
+// disagrees with an existing exchange fails the channel, so the publisher and
+// every consumer group declare it through here.
+func declareExchange(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(ExchangeName, "topic", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare exchange %s: %w", ExchangeName, err)
+	}
+	return nil
+}
+
+// DeclareConsumerGroup declares group's queue, binds it to every routing key
+// in keys, and declares its retry tiers and parking queue.
 //
-// queueName identifies the consumer group. Two replicas of the same subscriber
+// group identifies the consumer group. Two replicas of the same subscriber
 // share a queue and compete for messages; two different subscribers use two
 // queue names and each receive every message.
-func SubscriberConfig(amqpURI, queueName string) wamqp.Config {
-	cfg := wamqp.NewDurablePubSubConfig(amqpURI, constant(queueName))
-	cfg.Exchange.GenerateName = constant(ExchangeName)
-	cfg.Exchange.Type = "topic"
-	cfg.Exchange.Durable = true
-	cfg.Queue.Durable = true
-	// The topic passed to Subscribe IS the routing key to bind with.
-	cfg.QueueBind.GenerateRoutingKey = identity
-	return cfg
+//
+// Every declaration is idempotent, so each replica runs it on start.
+func DeclareConsumerGroup(ch *amqp.Channel, group string, keys []string, policy RetryPolicy) error {
+	if err := declareExchange(ch); err != nil {
+		return err
+	}
+	for _, name := range []string{RetryExchange, DeadLetterExchange} {
+		if err := ch.ExchangeDeclare(name, "direct", true, false, false, false, nil); err != nil {
+			return fmt.Errorf("declare exchange %s: %w", name, err)
+		}
+	}
+
+	// A parked message goes to the parking queue by way of the DLX: published
+	// there by the consumer with its error, or, failing that, rejected.
+	parked := ParkingQueueName(group)
+	if _, err := ch.QueueDeclare(parked, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare queue %s: %w", parked, err)
+	}
+	if err := ch.QueueBind(parked, parked, DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("bind queue %s: %w", parked, err)
+	}
+
+	if _, err := ch.QueueDeclare(group, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    DeadLetterExchange,
+		"x-dead-letter-routing-key": parked,
+	}); err != nil {
+		return fmt.Errorf("declare queue %s: %w", group, err)
+	}
+	for _, key := range keys {
+		if err := ch.QueueBind(group, key, ExchangeName, false, nil); err != nil {
+			return fmt.Errorf("bind queue %s to %s: %w", group, key, err)
+		}
+	}
+
+	// A delay queue has no consumer. Its messages expire after the tier's TTL
+	// and are dead-lettered through the default exchange straight back onto
+	// the group's queue, which records the expiry in their x-death header.
+	for _, delay := range policy.Delays {
+		q := RetryQueueName(group, delay)
+		if _, err := ch.QueueDeclare(q, true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": group,
+		}); err != nil {
+			return fmt.Errorf("declare queue %s: %w", q, err)
+		}
+		if err := ch.QueueBind(q, q, RetryExchange, false, nil); err != nil {
+			return fmt.Errorf("bind queue %s: %w", q, err)
+		}
+	}
+	return nil
+}
+
+// Deliveries is how many times a message carrying headers has been delivered
+// to group, this delivery included.
+//
+// It is read from the x-death header the broker maintains: every pass through
+// one of group's delay queues adds to the count of an "expired" entry for that
+// queue. A consumer that crashes between republishing and acking cannot lose
+// or double count it.
+//
+// The consumer republishes a failed message to send it to a delay queue, and
+// the broker only carries x-death across that republish because it reads the
+// header back off a message a client published. Not every RabbitMQ release
+// does, and one that does not starts a fresh history each time, which would
+// retry a failing message forever. So the consumer also stamps
+// DeliveriesHeader on every retry, and the higher of the two counts wins.
+func Deliveries(headers amqp.Table, group string) int {
+	n := 1 + expiries(headers, group)
+	if stamped, ok := asInt(headers[DeliveriesHeader]); ok {
+		n = max(n, stamped+1)
+	}
+	return n
+}
+
+// expiries totals the expiries x-death records from group's delay queues.
+func expiries(headers amqp.Table, group string) int {
+	deaths, _ := headers["x-death"].([]any)
+	n := 0
+	for _, d := range deaths {
+		death, ok := d.(amqp.Table)
+		if !ok {
+			continue
+		}
+		queue, _ := death["queue"].(string)
+		reason, _ := death["reason"].(string)
+		if reason != "expired" || !isRetryQueue(queue, group) {
+			continue
+		}
+		if c, ok := asInt(death["count"]); ok {
+			n += c
+		}
+	}
+	return n
+}
+
+// asInt reads an integer header value, whichever width it was encoded as.
+func asInt(v any) (int, bool) {
+	switch v := v.(type) {
+	case int64:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
+
+func isRetryQueue(queue, group string) bool {
+	prefix := group + ".retry."
+	return len(queue) > len(prefix) && queue[:len(prefix)] == prefix
 }
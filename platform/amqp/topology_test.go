@@ -0,0 +1,102 @@
+package amqp_test
+
+import (
+	"testing"
+	"time"
+
+	platformamqp "eventify/platform/amqp"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := platformamqp.RetryPolicy{
+		Delays:        []time.Duration{time.Second, time.Minute},
+		MaxDeliveries: 4,
+	}
+
+	tests := []struct {
+		deliveries int
+		wantDelay  time.Duration
+		wantPark   bool
+	}{
+		{1, time.Second, false},
+		{2, time.Minute, false},
+		{3, time.Minute, false}, // past the last tier, stay on it
+		{4, 0, true},            // the MaxDeliveries-th failure parks
+	}
+	for _, tt := range tests {
+		d, park := p.Delay(tt.deliveries)
+		if d != tt.wantDelay || park != tt.wantPark {
+			t.Errorf("Delay(%d) = %v, %v; want %v, %v", tt.deliveries, d, park, tt.wantDelay, tt.wantPark)
+		}
+	}
+
+	if _, park := (platformamqp.RetryPolicy{MaxDeliveries: 10}).Delay(1); !park {
+		t.Error("a policy without delays must park at once")
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	if got := platformamqp.Deliveries(nil, "eventify.analytics"); got != 1 {
+		t.Errorf("first delivery: got %d, want 1", got)
+	}
+
+	headers := amqp.Table{"x-death": []any{
+		amqp.Table{"queue": "eventify.analytics.retry.5s", "reason": "expired", "count": int64(1)},
+		amqp.Table{"queue": "eventify.analytics.retry.30s", "reason": "expired", "count": int64(2)},
+		// Another group's retries, and a rejection, are not this group's
+		// deliveries.
+		amqp.Table{"queue": "eventify.audit.retry.5s", "reason": "expired", "count": int64(7)},
+		amqp.Table{"queue": "eventify.analytics", "reason": "rejected", "count": int64(1)},
+	}}
+	if got := platformamqp.Deliveries(headers, "eventify.analytics"); got != 4 {
+		t.Errorf("after three retries: got %d, want 4", got)
+	}
+
+	// A broker that does not carry x-death across the consumer's republish
+	// records only the latest expiry. The consumer's own count still holds.
+	headers = amqp.Table{
+		platformamqp.DeliveriesHeader: int64(3),
+		"x-death": []any{
+			amqp.Table{"queue": "eventify.analytics.retry.30s", "reason": "expired", "count": int64(1)},
+		},
+	}
+	if got := platformamqp.Deliveries(headers, "eventify.analytics"); got != 4 {
+		t.Errorf("with x-death reset: got %d, want 4", got)
+	}
+
+	// And one that does carry it agrees with the stamp; neither is added to
+	// the other.
+	headers = amqp.Table{
+		platformamqp.DeliveriesHeader: int64(3),
+		"x-death": []any{
+			amqp.Table{"queue": "eventify.analytics.retry.5s", "reason": "expired", "count": int64(1)},
+			amqp.Table{"queue": "eventify.analytics.retry.30s", "reason": "expired", "count": int64(2)},
+		},
+	}
+	if got := platformamqp.Deliveries(headers, "eventify.analytics"); got != 4 {
+		t.Errorf("with x-death carried: got %d, want 4", got)
+	}
+}
+
+func TestOriginalRoutingKey(t *testing.T) {
+	const key = "eventify.events.EventCreated"
+
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		arrived string
+	}{
+		{"never retried", nil, key},
+		{"retried or parked by the consumer", amqp.Table{platformamqp.RoutingKeyHeader: key}, "eventify.analytics"},
+		{"rejected by the broker", amqp.Table{"x-death": []any{
+			amqp.Table{"queue": "eventify.analytics", "reason": "rejected", "routing-keys": []any{key}},
+		}}, "eventify.analytics.parked"},
+	}
+	for _, tt := range tests {
+		if got := platformamqp.OriginalRoutingKey(tt.headers, tt.arrived); got != key {
+			t.Errorf("%s: got %q, want %q", tt.name, got, key)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package cli holds what the operator commands — outboxctl, dlq — share
+// beyond their flags: how a usage mistake is reported, and how lists and
+// table cells are read and written.
+package cli
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUsage marks a mistake in the command line. A command wraps it, and main
+// exits 2 rather than 1 for an error that does.
+var ErrUsage = errors.New("usage")
+
+// SplitList splits a comma-separated flag value, trimming each entry and
+// dropping the empty ones, so "a, b,," is [a b].
+func SplitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// OneLine flattens s for a table cell and cuts it to n runes.
+func OneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
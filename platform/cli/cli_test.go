@@ -0,0 +1,44 @@
+package cli_test
+
+import (
+	"slices"
+	"testing"
+
+	"eventify/platform/cli"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a, b,,", []string{"a", "b"}},
+		{" , ", nil},
+	}
+	for _, tt := range tests {
+		if got := cli.SplitList(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"line one\n\tline two", 40, "line one line two"},
+		{"exactly ten", 11, "exactly ten"},
+		{"one too many", 11, "one too ma…"},
+		{"ünïcödé strïng", 8, "ünïcödé…"},
+	}
+	for _, tt := range tests {
+		if got := cli.OneLine(tt.in, tt.n); got != tt.want {
+			t.Errorf("OneLine(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -56,3 +57,21 @@ func Duration(key string, def time.Duration) time.Duration {
 	}
 	return d
 }
+
+// Durations returns the value of key parsed as a comma-separated list of
+// durations, or def when unset or when any element is invalid.
+func Durations(key string, def []time.Duration) []time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var out []time.Duration
+	for _, s := range strings.Split(v, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return def
+		}
+		out = append(out, d)
+	}
+	return out
+}
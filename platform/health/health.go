@@ -0,0 +1,211 @@
+// Package health serves the liveness and readiness endpoints an orchestrator
+// probes: /healthz, which fails when the process is stuck and should be
+// restarted, and /readyz, which fails while it cannot do its work and should
+// be sent none.
+//
+// A binary registers named checks on a Health and mounts its handlers. Each
+// probe runs its checks concurrently, each bounded by a timeout, and answers
+// 200 if every one passed and 503 otherwise, with a JSON body naming what
+// failed:
+//
+//	{"status":"unavailable","checks":{"postgres":"ok","amqp":"not connected"}}
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each check. A dependency that has not answered by
+// then is as good as down, as far as a probe is concerned.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether one dependency is healthy. It should return promptly
+// once ctx is done; if it does not, the probe answers without it.
+type Check func(ctx context.Context) error
+
+// Health holds a binary's checks.
+type Health struct {
+	mu      sync.Mutex
+	live    []named
+	ready   []named
+	timeout time.Duration
+}
+
+type named struct {
+	name  string
+	check Check
+}
+
+// New returns a Health with no checks, which reports healthy and ready.
+func New() *Health {
+	return &Health{timeout: DefaultTimeout}
+}
+
+// Live registers a liveness check: one whose failure means the process will
+// not recover by itself. Liveness checks run on /readyz too, since a process
+// that should be restarted should not be sent work meanwhile.
+//
+// Keep them to the process's own state. A liveness check on a shared
+// dependency restarts every replica at once when that dependency blips.
+func (h *Health) Live(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.live = append(h.live, named{name, c})
+}
+
+// Ready registers a readiness check: one whose failure means the process
+// cannot do its work right now, but may once a dependency comes back.
+func (h *Health) Ready(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = append(h.ready, named{name, c})
+}
+
+// LiveHandler serves /healthz.
+func (h *Health) LiveHandler() http.Handler {
+	return h.handler(h.liveChecks)
+}
+
+// ReadyHandler serves /readyz.
+func (h *Health) ReadyHandler() http.Handler {
+	return h.handler(h.readyChecks)
+}
+
+// Mount registers /healthz and /readyz on mux.
+func (h *Health) Mount(mux *http.ServeMux) {
+	mux.Handle("/healthz", h.LiveHandler())
+	mux.Handle("/readyz", h.ReadyHandler())
+}
+
+// CheckLive runs the liveness checks, for a transport that is not HTTP, and
+// returns their failures joined, each prefixed with its check's name.
+func (h *Health) CheckLive(ctx context.Context) error {
+	_, err := h.probe(ctx, h.liveChecks())
+	return err
+}
+
+// CheckReady runs the readiness checks, liveness checks included, as
+// CheckLive does.
+func (h *Health) CheckReady(ctx context.Context) error {
+	_, err := h.probe(ctx, h.readyChecks())
+	return err
+}
+
+func (h *Health) liveChecks() []named {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]named{}, h.live...)
+}
+
+func (h *Health) readyChecks() []named {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append(append([]named{}, h.live...), h.ready...)
+}
+
+// report is the body of a probe's response.
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// probe runs cs and reports on each, returning an error if any failed.
+func (h *Health) probe(ctx context.Context, cs []named) (report, error) {
+	errs := h.run(ctx, cs)
+	rep := report{Status: "ok", Checks: make(map[string]string, len(cs))}
+	var failed []error
+	for i, c := range cs {
+		rep.Checks[c.name] = "ok"
+		if errs[i] != nil {
+			rep.Checks[c.name] = errs[i].Error()
+			rep.Status = "unavailable"
+			failed = append(failed, fmt.Errorf("%s: %w", c.name, errs[i]))
+		}
+	}
+	return rep, errors.Join(failed...)
+}
+
+func (h *Health) handler(checks func() []named) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep, err := h.probe(r.Context(), checks())
+		code := http.StatusOK
+		if err != nil {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(rep)
+	})
+}
+
+// run runs cs concurrently and returns their errors in order. A check still
+// running at the timeout is reported as timed out and left to finish alone.
+func (h *Health) run(ctx context.Context, cs []named) []error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	errs := make([]error, len(cs))
+	var wg sync.WaitGroup
+	for i, c := range cs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := make(chan error, 1)
+			go func() { result <- c.check(ctx) }()
+			select {
+			case errs[i] = <-result:
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("timed out after %s", h.timeout)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// Pinger is anything that answers a ping: a *pgxpool.Pool, among others.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks p answers a ping.
+func Ping(p Pinger) Check {
+	return p.Ping
+}
+
+// Connected checks a connection that reconnects by itself, such as an AMQP
+// consumer's, is up right now.
+func Connected(up func() bool) Check {
+	return func(context.Context) error {
+		if !up() {
+			return errors.New("not connected")
+		}
+		return nil
+	}
+}
+
+// Recent checks that last, the time some loop last made progress, is no
+// older than maxAge. A zero time means the loop has not started.
+//
+// It catches what pinging dependencies cannot: a loop wedged on a dead
+// connection or a lock, beside a pool that pings fine.
+func Recent(last func() time.Time, maxAge time.Duration) Check {
+	return func(context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return errors.New("not started")
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("last progress %s ago, more than %s", age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
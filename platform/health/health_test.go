@@ -0,0 +1,67 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"eventify/platform/health"
+)
+
+func probe(t *testing.T, h http.Handler) (int, map[string]string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body.Checks
+}
+
+func TestHealth_ReadinessFailsWithoutFailingLiveness(t *testing.T) {
+	h := health.New()
+	h.Live("loop", func(context.Context) error { return nil })
+	h.Ready("postgres", func(context.Context) error { return errors.New("connection refused") })
+
+	if code, checks := probe(t, h.LiveHandler()); code != http.StatusOK || len(checks) != 1 {
+		t.Errorf("/healthz = %d %v, want 200 with the liveness check alone", code, checks)
+	}
+	code, checks := probe(t, h.ReadyHandler())
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz = %d, want 503", code)
+	}
+	if checks["loop"] != "ok" || checks["postgres"] != "connection refused" {
+		t.Errorf("/readyz checks = %v", checks)
+	}
+}
+
+func TestHealth_NoChecksIsHealthy(t *testing.T) {
+	if code, _ := probe(t, health.New().ReadyHandler()); code != http.StatusOK {
+		t.Errorf("/readyz = %d, want 200", code)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	ctx := context.Background()
+	last := time.Time{}
+	check := health.Recent(func() time.Time { return last }, time.Minute)
+
+	if check(ctx) == nil {
+		t.Error("zero time passed, want not started")
+	}
+	last = time.Now()
+	if err := check(ctx); err != nil {
+		t.Errorf("fresh time failed: %v", err)
+	}
+	last = time.Now().Add(-2 * time.Minute)
+	if check(ctx) == nil {
+		t.Error("stale time passed")
+	}
+}
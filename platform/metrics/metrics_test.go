@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eventify/platform/metrics"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestHandler_WritesTheTextFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+	failures := reg.Counter("publish_failures_total", "Failed publishes.", "payload_type")
+	failures.Inc("EventCreated")
+	failures.Add(2, "EventCreated")
+	failures.Inc(`Odd"Type`)
+
+	queued := reg.Gauge("queued", "Queued rows.")
+	queued.Set(7)
+
+	latency := reg.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "event")
+	latency.Observe(0.05, "EventCreated")
+	latency.Observe(0.5, "EventCreated")
+	latency.Observe(5, "EventCreated")
+
+	want := `# HELP publish_failures_total Failed publishes.
+# TYPE publish_failures_total counter
+publish_failures_total{payload_type="EventCreated"} 3
+publish_failures_total{payload_type="Odd\"Type"} 1
+# HELP queued Queued rows.
+# TYPE queued gauge
+queued 7
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{event="EventCreated",le="0.1"} 1
+latency_seconds_bucket{event="EventCreated",le="1"} 2
+latency_seconds_bucket{event="EventCreated",le="+Inf"} 3
+latency_seconds_sum{event="EventCreated"} 5.55
+latency_seconds_count{event="EventCreated"} 3
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("scrape =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// A gauge that costs a query is refreshed by a hook, before it is written.
+func TestHandler_RunsScrapeHooksFirst(t *testing.T) {
+	reg := metrics.NewRegistry()
+	g := reg.Gauge("scrapes", "Scrapes so far.")
+	n := 0
+	reg.OnScrape(func(context.Context) {
+		n++
+		g.Set(float64(n))
+	})
+
+	scrape(t, reg)
+	if got := scrape(t, reg); !strings.Contains(got, "\nscrapes 2\n") {
+		t.Errorf("second scrape =\n%s\nwant scrapes 2", got)
+	}
+}
+
+func TestRegistry_PanicsOnMisuse(t *testing.T) {
+	for name, fn := range map[string]func(*metrics.Registry){
+		"duplicate name": func(r *metrics.Registry) {
+			r.Counter("x", "")
+			r.Gauge("x", "")
+		},
+		"wrong label count": func(r *metrics.Registry) {
+			r.Counter("x", "", "a", "b").Inc("only-one")
+		},
+		"negative counter": func(r *metrics.Registry) {
+			r.Counter("x", "").Add(-1)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			fn(metrics.NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// TraceparentHeader is the W3C Trace Context header that carries a span's
+// identity from one process to the next.
+const TraceparentHeader = "traceparent"
+
+// traceContext is the W3C propagator, used explicitly rather than through
+// otel's global one. The global is only set by InitTracer, and a process that
+// never exports spans must still pass the trace it was handed along — the
+// relay does nothing else with it.
+var traceContext = propagation.TraceContext{}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or "" if ctx
+// carries none.
+//
+// An event's trace crosses a database row and a broker before it reaches a
+// consumer, and neither carries a context.Context. This string is what does.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get(TraceparentHeader)
+}
+
+// WithTraceparent returns ctx with the remote span traceparent names as its
+// parent, so the next span started from it joins that trace. An empty or
+// malformed traceparent leaves ctx as it was.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{TraceparentHeader: traceparent})
+}
+
+// StartSpan starts a span named name as a child of whatever span ctx carries,
+// and returns the context carrying it and a function that ends it. Passing
+// end a non-nil error marks the span failed.
+func StartSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, func(err error)) {
+	ctx, span := otel.Tracer(_serviceName).Start(ctx, name)
+	for k, v := range attrs {
+		span.SetAttributes(attribute.String(k, v))
+	}
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,41 @@
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+
+	"eventify/platform/telemetry"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceparent_RoundTrips(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	tp := telemetry.Traceparent(ctx)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; tp != want {
+		t.Fatalf("Traceparent = %q, want %q", tp, want)
+	}
+
+	got := trace.SpanContextFromContext(telemetry.WithTraceparent(context.Background(), tp))
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsRemote() {
+		t.Errorf("WithTraceparent(%q) = %v, want the remote span %v", tp, got, sc)
+	}
+}
+
+func TestTraceparent_EmptyWithoutASpan(t *testing.T) {
+	if tp := telemetry.Traceparent(context.Background()); tp != "" {
+		t.Errorf("Traceparent without a span = %q, want empty", tp)
+	}
+	for _, tp := range []string{"", "not-a-traceparent"} {
+		ctx := telemetry.WithTraceparent(context.Background(), tp)
+		if trace.SpanContextFromContext(ctx).IsValid() {
+			t.Errorf("WithTraceparent(%q) produced a span context", tp)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package dlq replays and discards the messages a consumer group has parked.
+// Command dlq is its command line; this is everything it does to a queue.
+package dlq
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"eventify/events"
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/cli"
+	"eventify/platform/telemetry"
+)
+
+// Selection chooses the parked messages a replay or a discard acts on. A
+// message matches when its ID is among IDs, if any are given, and its event
+// name is Type, if one is given. The event name is the one its envelope
+// carries, or, for a message sent without one, the one its routing key spells.
+type Selection struct {
+	IDs  []string
+	Type string
+	// All must be set to select every parked message, so that no selection
+	// does by omission.
+	All bool
+}
+
+// Check reports, wrapping cli.ErrUsage, a selection that names nothing. Acting
+// on a whole parking queue is one typo from replaying a thousand poisoned
+// messages.
+func (s Selection) Check() error {
+	if len(s.IDs) == 0 && s.Type == "" && !s.All {
+		return fmt.Errorf("%w: needs -id or -type, or -all to act on every parked message", cli.ErrUsage)
+	}
+	return nil
+}
+
+// Matches reports whether s selects p.
+func (s Selection) Matches(p platformamqp.Parked) bool {
+	if len(s.IDs) > 0 && !slices.Contains(s.IDs, p.MessageId) {
+		return false
+	}
+	if s.Type != "" && eventName(p) != s.Type {
+		return false
+	}
+	return true
+}
+
+// eventName is the event p carries. It reads the envelope's name header alone,
+// so a message parked for a malformed envelope can still be selected by it.
+func eventName(p platformamqp.Parked) string {
+	if name, _ := p.Headers[events.HeaderName].(string); name != "" {
+		return name
+	}
+	name, _ := events.NameFromRoutingKey(p.RoutingKey)
+	return name
+}
+
+// Replay publishes each message sel selects from group's parking queue to the
+// eventify exchange, under the routing key it was first published with, and
+// acks the parked copy only once pub has had the new one confirmed. A crash
+// between the two leaves both, so a replayed event can arrive twice. It also
+// reaches every consumer group bound to its routing key, not just group.
+//
+// The new copy keeps the old one's envelope and traceparent and none of its
+// other headers, so it starts again with a full retry budget.
+//
+// Replay returns the messages it replayed, those before the failure when it
+// fails. A dry run returns the same messages, publishes nothing, and may pass
+// a nil pub.
+func Replay(ctx context.Context, uri, group string, sel Selection, pub *platformamqp.Publisher, dryRun bool) ([]platformamqp.Parked, error) {
+	if err := sel.Check(); err != nil {
+		return nil, err
+	}
+	return act(ctx, uri, group, sel, dryRun, func(p platformamqp.Parked) error {
+		// The replay continues the trace the message was produced in, and
+		// keeps its envelope: it is the same message, from the same producer.
+		tp, _ := p.Headers[telemetry.TraceparentHeader].(string)
+		pctx := telemetry.WithTraceparent(ctx, tp)
+		env, err := events.ParseEnvelope(p.Headers)
+		if err != nil {
+			return fmt.Errorf("replay %s: %w", p.MessageId, err)
+		}
+		if env != nil {
+			pctx = platformamqp.WithHeaders(pctx, env.Headers())
+		}
+		if err := pub.Publish(pctx, p.RoutingKey, p.MessageId, p.Body); err != nil {
+			return fmt.Errorf("replay %s: %w", p.MessageId, err)
+		}
+		return nil
+	})
+}
+
+// Discard deletes each message sel selects from group's parking queue, and
+// returns them. A dry run returns the same messages and deletes nothing.
+func Discard(ctx context.Context, uri, group string, sel Selection, dryRun bool) ([]platformamqp.Parked, error) {
+	if err := sel.Check(); err != nil {
+		return nil, err
+	}
+	return act(ctx, uri, group, sel, dryRun, func(platformamqp.Parked) error { return nil })
+}
+
+// act runs fn on every parked message sel selects and acks it, taking it off
+// the parking queue, once fn succeeds. A dry run calls and acks nothing; every
+// message it looked at goes back.
+func act(ctx context.Context, uri, group string, sel Selection, dryRun bool, fn func(platformamqp.Parked) error) ([]platformamqp.Parked, error) {
+	var done []platformamqp.Parked
+	err := platformamqp.WalkParked(ctx, uri, group, 0, func(p platformamqp.Parked) error {
+		if !sel.Matches(p) {
+			return nil
+		}
+		if !dryRun {
+			if err := fn(p); err != nil {
+				return err
+			}
+			if err := p.Ack(false); err != nil {
+				return fmt.Errorf("ack %s: %w", p.MessageId, err)
+			}
+		}
+		done = append(done, p)
+		return nil
+	})
+	return done, err
+}
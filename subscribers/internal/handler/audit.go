@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"eventify/events"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// auditEntry is what the audit log keeps of one event.
+type auditEntry struct {
+	MessageID  uuid.UUID
+	UserID     uuid.UUID
+	DoneBy     string
+	OccurredAt time.Time
+}
+
+// Audit records one user lifecycle event in the audit log. There is one per
+// event name, each built by its own constructor, because each decodes its own
+// contract; they differ in nothing else.
+type Audit struct {
+	name  string
+	entry func(payload []byte) (auditEntry, error)
+	log   *logger.Logger
+}
+
+// NewUserSignedUpAudit audits signups. The account signed itself up, so it is
+// recorded as the one who did it.
+func NewUserSignedUpAudit(log *logger.Logger) *Audit {
+	return &Audit{name: events.UserSignedUpName, log: log, entry: func(payload []byte) (auditEntry, error) {
+		var evt events.UserSignedUp
+		err := json.Unmarshal(payload, &evt)
+		return auditEntry{evt.MessageID, evt.UserID, evt.UserID.String(), evt.OccurredAt}, err
+	}}
+}
+
+// NewRoleAssignedAudit audits role grants.
+func NewRoleAssignedAudit(log *logger.Logger) *Audit {
+	return &Audit{name: events.RoleAssignedName, log: log, entry: func(payload []byte) (auditEntry, error) {
+		var evt events.RoleAssigned
+		err := json.Unmarshal(payload, &evt)
+		return auditEntry{evt.MessageID, evt.UserID, evt.DoneBy, evt.OccurredAt}, err
+	}}
+}
+
+// NewPasswordChangedAudit audits password changes.
+func NewPasswordChangedAudit(log *logger.Logger) *Audit {
+	return &Audit{name: events.PasswordChangedName, log: log, entry: func(payload []byte) (auditEntry, error) {
+		var evt events.PasswordChanged
+		err := json.Unmarshal(payload, &evt)
+		return auditEntry{evt.MessageID, evt.UserID, evt.DoneBy, evt.OccurredAt}, err
+	}}
+}
+
+// Name is the event this handler consumes.
+func (h *Audit) Name() string { return h.name }
+
+// HandleTx appends the event to the audit log, keeping its payload as it
+// arrived. A redelivery collides on message_id and changes nothing, as in
+// EventCreated.
+func (h *Audit) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	e, err := h.entry(payload)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s payload: %w", h.name, err)
+	}
+	if e.MessageID == uuid.Nil {
+		return fmt.Errorf("%s payload carries no message_id; cannot deduplicate", h.name)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO audit_log (message_id, event, user_id, done_by, payload, occurred_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (message_id) DO NOTHING`,
+		e.MessageID, h.name, e.UserID, e.DoneBy, json.RawMessage(payload), e.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("record %s %s: %w", h.name, e.MessageID, err)
+	}
+
+	h.log.WithFields(logger.Fields{
+		"message_id": e.MessageID,
+		"user_id":    e.UserID,
+		"done_by":    e.DoneBy,
+	}).Info("audited " + h.name)
+	return nil
+}
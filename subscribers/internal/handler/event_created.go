@@ -7,26 +7,25 @@ import (
 
 	"eventify/events"
 	"eventify/platform/logger"
-	"eventify/platform/postgres"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 // EventCreated projects the EventCreated event into the analytics read model.
 type EventCreated struct {
-	db  postgres.Querier
 	log *logger.Logger
 }
 
 // NewEventCreated builds the handler.
-func NewEventCreated(db postgres.Querier, log *logger.Logger) *EventCreated {
-	return &EventCreated{db: db, log: log}
+func NewEventCreated(log *logger.Logger) *EventCreated {
+	return &EventCreated{log: log}
 }
 
 // Name is the event this handler consumes.
 func (h *EventCreated) Name() string { return events.EventCreatedName }
 
-// Handle persists the event idempotently.
+// HandleTx persists the event idempotently.
 //
 // The outbox relay guarantees at-least-once delivery, so this method must
 // tolerate seeing the same MessageID twice. ON CONFLICT DO NOTHING makes the
@@ -36,7 +35,7 @@ func (h *EventCreated) Name() string { return events.EventCreatedName }
 // the same value today, but only the payload survives a replay from a dump or a
 // hop through a bridge that does not preserve message IDs — and a lost
 // deduplication key silently turns at-least-once into duplicate rows.
-func (h *EventCreated) Handle(ctx context.Context, payload []byte) error {
+func (h *EventCreated) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
 	var evt events.EventCreated
 	if err := json.Unmarshal(payload, &evt); err != nil {
 		return fmt.Errorf("unmarshal %s payload: %w", events.EventCreatedName, err)
@@ -45,7 +44,7 @@ func (h *EventCreated) Handle(ctx context.Context, payload []byte) error {
 		return fmt.Errorf("%s payload carries no message_id; cannot deduplicate", events.EventCreatedName)
 	}
 
-	_, err := h.db.Exec(ctx,
+	_, err := tx.Exec(ctx,
 		`INSERT INTO analytics_events
 		     (message_id, event_id, name, type, created_by, occurred_at)
 		 VALUES ($1, $2, $3, $4, $5, $6)
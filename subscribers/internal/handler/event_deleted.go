@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"eventify/events"
+	"eventify/platform/logger"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EventDeleted marks an event's analytics row deleted.
+type EventDeleted struct {
+	log *logger.Logger
+}
+
+// NewEventDeleted builds the handler.
+func NewEventDeleted(log *logger.Logger) *EventDeleted {
+	return &EventDeleted{log: log}
+}
+
+// Name is the event this handler consumes.
+func (h *EventDeleted) Name() string { return events.EventDeletedName }
+
+// HandleTx records who deleted the event when. The row stays: the read model
+// still counts what was created. A row already marked deleted is left as it
+// is, so a duplicate changes nothing.
+func (h *EventDeleted) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	var evt events.EventDeleted
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return fmt.Errorf("unmarshal %s payload: %w", events.EventDeletedName, err)
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE analytics_events
+		    SET deleted_at = $2, deleted_by = $3
+		  WHERE event_id = $1 AND deleted_at IS NULL`,
+		evt.ID, evt.OccurredAt, evt.DoneBy,
+	)
+	if err != nil {
+		return fmt.Errorf("apply %s %s: %w", events.EventDeletedName, evt.MessageID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		ok, err := projected(ctx, tx, evt.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s %s for event %s: %w", events.EventDeletedName, evt.MessageID, evt.ID, ErrNotProjected)
+		}
+		return nil
+	}
+
+	h.log.WithFields(logger.Fields{
+		"message_id": evt.MessageID,
+		"event_id":   evt.ID,
+		"done_by":    evt.DoneBy,
+	}).Info("projected EventDeleted")
+	return nil
+}
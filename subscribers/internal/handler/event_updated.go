@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"eventify/events"
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotProjected is returned for an update or deletion of an event whose
+// creation the read model has not seen. Its EventCreated is usually still on
+// its way, on another worker or behind a retry, so the message goes back to
+// the consumer's retry policy to wait for it. One whose creation never
+// arrives ends up parked, where the dlq tool can replay it once it has.
+var ErrNotProjected = errors.New("event not projected yet")
+
+// EventUpdated applies the EventUpdated event to the event's analytics row.
+type EventUpdated struct {
+	log *logger.Logger
+}
+
+// NewEventUpdated builds the handler.
+func NewEventUpdated(log *logger.Logger) *EventUpdated {
+	return &EventUpdated{log: log}
+}
+
+// Name is the event this handler consumes.
+func (h *EventUpdated) Name() string { return events.EventUpdatedName }
+
+// HandleTx updates the row's name and type, and records who updated it when.
+//
+// An update older than the one last applied is dropped, as is any update to a
+// deleted event. The relay publishes one event's messages in order, but more
+// than one consumer worker, or a retry, can apply them out of it.
+// OccurredAt is stamped while the producer holds the event's row lock, so it
+// orders one event's updates as they committed.
+func (h *EventUpdated) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	var evt events.EventUpdated
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return fmt.Errorf("unmarshal %s payload: %w", events.EventUpdatedName, err)
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE analytics_events
+		    SET name = $2, type = $3, updated_at = $4, updated_by = $5
+		  WHERE event_id = $1
+		    AND deleted_at IS NULL
+		    AND (updated_at IS NULL OR updated_at < $4)`,
+		evt.ID, evt.Name, evt.Type, evt.OccurredAt, evt.DoneBy,
+	)
+	if err != nil {
+		return fmt.Errorf("apply %s %s: %w", events.EventUpdatedName, evt.MessageID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return h.skip(ctx, tx, evt.ID, evt.MessageID)
+	}
+
+	h.log.WithFields(logger.Fields{
+		"message_id":     evt.MessageID,
+		"event_id":       evt.ID,
+		"changed_fields": evt.ChangedFields,
+		"done_by":        evt.DoneBy,
+	}).Info("projected EventUpdated")
+	return nil
+}
+
+// skip explains an update that touched no row: stale, or too early.
+func (h *EventUpdated) skip(ctx context.Context, tx pgx.Tx, eventID, messageID uuid.UUID) error {
+	ok, err := projected(ctx, tx, eventID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s %s for event %s: %w", events.EventUpdatedName, messageID, eventID, ErrNotProjected)
+	}
+	h.log.WithFields(logger.Fields{
+		"message_id": messageID,
+		"event_id":   eventID,
+	}).Info("skipped EventUpdated older than the row, or for a deleted event")
+	return nil
+}
+
+// projected reports whether the read model has a row for eventID.
+func projected(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) (bool, error) {
+	var ok bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM analytics_events WHERE event_id = $1)`, eventID,
+	).Scan(&ok); err != nil {
+		return false, fmt.Errorf("look up analytics event %s: %w", eventID, err)
+	}
+	return ok, nil
+}
@@ -7,26 +7,42 @@ import (
 	"fmt"
 
 	"eventify/events"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Handler consumes one event.
 //
-// Handle receives the raw payload bytes rather than a decoded struct: the
+// HandleTx receives the raw payload bytes rather than a decoded struct: the
 // registry cannot know the concrete type, and decoding belongs to the handler
 // anyway, since it is the only code that knows which contract the name implies.
+//
+// It also receives the transaction the registry opened for the message, and
+// makes every write through it. A projection touching several rows is then
+// atomic, and a follow-up event enqueued with outbox.Enqueue(ctx, tx, ...)
+// commits with the projection that caused it — or not at all. It must not
+// commit or roll tx back itself.
+//
+// Delivery is at least once, so HandleTx must tolerate a duplicate. A handler
+// whose writes have no natural key to collide on is registered through
+// Idempotent.
 type Handler interface {
 	Name() string
-	Handle(ctx context.Context, payload []byte) error
+	HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error
 }
 
-// Registry resolves an event name to its Handler.
+// Registry resolves an event name to its Handler, and runs it in a
+// transaction.
 type Registry struct {
+	pool     *pgxpool.Pool
 	handlers map[string]Handler
 }
 
 // NewRegistry builds a Registry from the given handlers, rejecting duplicates.
-func NewRegistry(hs ...Handler) (*Registry, error) {
-	r := &Registry{handlers: make(map[string]Handler, len(hs))}
+// Each message is handled in a transaction on pool.
+func NewRegistry(pool *pgxpool.Pool, hs ...Handler) (*Registry, error) {
+	r := &Registry{pool: pool, handlers: make(map[string]Handler, len(hs))}
 	for _, h := range hs {
 		if _, dup := r.handlers[h.Name()]; dup {
 			return nil, fmt.Errorf("duplicate handler registered for %s", h.Name())
@@ -36,6 +52,14 @@ func NewRegistry(hs ...Handler) (*Registry, error) {
 	return r, nil
 }
 
+// Use wraps every registered handler in mws, the first outermost. Call it
+// once, before the first Dispatch.
+func (r *Registry) Use(mws ...Middleware) {
+	for name, h := range r.handlers {
+		r.handlers[name] = Chain(h, mws...)
+	}
+}
+
 // Names lists every event this subscriber consumes.
 func (r *Registry) Names() []string {
 	names := make([]string, 0, len(r.handlers))
@@ -45,6 +69,14 @@ func (r *Registry) Names() []string {
 	return names
 }
 
+// Handles reports whether a handler is registered for name. A name a message
+// carries is chosen by its producer; check it here before letting it into
+// anything with a bounded set of values, such as a metric label.
+func (r *Registry) Handles(name string) bool {
+	_, ok := r.handlers[name]
+	return ok
+}
+
 // RoutingKeys lists every key the subscriber must bind its queue to.
 func (r *Registry) RoutingKeys() []string {
 	keys := make([]string, 0, len(r.handlers))
@@ -54,15 +86,49 @@ func (r *Registry) RoutingKeys() []string {
 	return keys
 }
 
-// Dispatch routes a payload to the handler registered for name.
+// Dispatch routes a payload to the handler registered for name, in a
+// transaction it commits only if the handler succeeds.
+//
+// If ctx carries the message's envelope — see events.WithEnvelope — its name
+// decides instead, and name is not consulted. The caller's name is only ever
+// inferred, from the key the message was routed under; the envelope is what
+// the producer said it sent. The payload is upcast from the envelope's
+// version to the one this binary decodes, before any handler sees it; see
+// events.Upcast. A message with no envelope is taken to be current.
+//
+// It returns once the commit has, so a caller that acks on a nil error acks
+// only a message whose writes are durable. A crash between the commit and the
+// ack redelivers a message already handled, which is the duplicate every
+// Handler must tolerate; the reverse order would lose it.
 //
 // An unknown name is an error, not a silent drop: it means a producer shipped
-// an event this binary was never taught to consume, and the message should be
-// nacked so it lands in the dead-letter queue rather than disappearing.
+// an event this binary was never taught to consume, and the message should
+// fail its retries and be parked rather than disappear.
 func (r *Registry) Dispatch(ctx context.Context, name string, payload []byte) error {
+	version := 0
+	if env := events.EnvelopeFrom(ctx); env != nil {
+		name, version = env.Name, env.Version
+	}
 	h, ok := r.handlers[name]
 	if !ok {
 		return fmt.Errorf("no handler registered for %s", name)
 	}
-	return h.Handle(ctx, payload)
+	payload, err := events.Upcast(name, version, payload)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := h.HandleTx(ctx, tx, payload); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit %s: %w", name, err)
+	}
+	return nil
 }
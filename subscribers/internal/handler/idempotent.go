@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"eventify/platform/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Idempotent makes a Handler safe under at-least-once delivery, whether or not
+// the handler's own writes have a key a duplicate could collide on.
+//
+// It records (consumer group, message_id) in processed_messages in the
+// message's transaction, beside the handler's writes, and skips a message
+// whose row is already there. The row commits if and only if the handler
+// succeeded, so a message that failed is handled again on redelivery, and one
+// that succeeded never is. Two deliveries of one message racing each other
+// serialise on the row's primary key: the second waits for the first to commit
+// or roll back.
+//
+// The handler's side effects outside the database — an email, an HTTP call —
+// are not in the transaction. They happen again if the commit fails after
+// them; the inbox narrows that window to the commit, and no further.
+type Idempotent struct {
+	group string
+	h     Handler
+	log   *logger.Logger
+}
+
+// NewIdempotent wraps h for consumer group group, which must be the queue the
+// subscriber consumes: two groups each handle every message once.
+func NewIdempotent(group string, h Handler, log *logger.Logger) *Idempotent {
+	return &Idempotent{group: group, h: h, log: log}
+}
+
+// Name is the wrapped handler's event.
+func (i *Idempotent) Name() string { return i.h.Name() }
+
+// HandleTx runs the wrapped handler once per message_id.
+//
+// The message_id is read from the payload, for the reason EventCreated.HandleTx
+// gives: it is the copy that survives every hop.
+func (i *Idempotent) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	id, err := messageID(payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", i.h.Name(), err)
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO processed_messages (consumer_group, message_id)
+		 VALUES ($1, $2)
+		 ON CONFLICT (consumer_group, message_id) DO NOTHING`,
+		i.group, id,
+	)
+	if err != nil {
+		return fmt.Errorf("record %s as processed: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		i.log.WithFields(logger.Fields{
+			"message_id":     id,
+			"consumer_group": i.group,
+		}).Info("skipped duplicate " + i.h.Name())
+		return nil
+	}
+	return i.h.HandleTx(ctx, tx, payload)
+}
+
+// messageID reads the message_id every eventify payload carries.
+func messageID(payload []byte) (uuid.UUID, error) {
+	var ids struct {
+		MessageID uuid.UUID `json:"message_id"`
+	}
+	if err := json.Unmarshal(payload, &ids); err != nil {
+		return uuid.Nil, fmt.Errorf("unmarshal payload: %w", err)
+	}
+	if ids.MessageID == uuid.Nil {
+		return uuid.Nil, errors.New("payload carries no message_id; cannot deduplicate")
+	}
+	return ids.MessageID, nil
+}
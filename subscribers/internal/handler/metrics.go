@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"eventify/platform/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Metrics records how long each message took to handle, by event name and
+// whether it succeeded, in reg. Like Logging it belongs near the outside of
+// the chain, so the time it records includes every retry and a timeout.
+//
+// It registers its histogram once, however many handlers it wraps.
+func Metrics(reg *metrics.Registry) Middleware {
+	duration := reg.Histogram("subscriber_handler_duration_seconds",
+		"Time to handle one message, retries included.", nil, "event", "result")
+	return func(next Handler) Handler {
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) error {
+			start := time.Now()
+			err := next.HandleTx(ctx, tx, payload)
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			duration.Since(start, next.Name(), result)
+			return err
+		}}
+	}
+}
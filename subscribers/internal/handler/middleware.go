@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"eventify/platform/logger"
+	"eventify/platform/telemetry"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Middleware decorates a Handler with behaviour every handler shares, so no
+// handler has to remember to time itself out, log itself, or survive its own
+// panics.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in mws. The first is outermost: it sees the message first and
+// the outcome last.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// wrapped is a Handler built from a function, keeping the name of the handler
+// it decorates so the registry still routes to it.
+type wrapped struct {
+	name string
+	fn   func(ctx context.Context, tx pgx.Tx, payload []byte) error
+}
+
+func (w wrapped) Name() string { return w.name }
+
+func (w wrapped) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	return w.fn(ctx, tx, payload)
+}
+
+// Timeout bounds one message's handling at d. Without it a handler waiting on
+// a lock or a slow external call holds its worker, its prefetch slot and its
+// transaction for as long as the dependency cares to take.
+//
+// The cancelled context aborts whatever statement the handler is running,
+// which fails the transaction, so the message is retried by the consumer.
+//
+// A non-positive d disables the bound and returns the handler unwrapped; a
+// zero deadline would fail every message before it started.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		if d <= 0 {
+			return next
+		}
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next.HandleTx(ctx, tx, payload)
+		}}
+	}
+}
+
+// Postgres errors that say nothing about the message: the same statements are
+// expected to succeed if simply run again.
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+	lockNotAvailable     = "55P03"
+)
+
+// isTransient reports whether err is a Postgres error worth retrying at once.
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case serializationFailure, deadlockDetected, lockNotAvailable:
+		return true
+	}
+	return false
+}
+
+// Retry runs a handler up to attempts times while it fails with a transient
+// Postgres error — a deadlock, a serialization failure, a lock timeout —
+// waiting backoff, then twice that, and so on between attempts.
+//
+// The consumer's retry policy would get there too, but only after a trip
+// through a delay queue measured in seconds, for a conflict that clears in
+// milliseconds. Any other error is returned at once, for that policy to deal
+// with.
+//
+// A failed statement aborts the transaction it ran in, and the transaction
+// belongs to the registry. So each attempt runs under a savepoint, and a
+// failed attempt rolls back to it: the retry starts clean, and the
+// transaction survives for the next attempt and the commit. An error that
+// kills the connection kills the savepoint with it, and is returned.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	attempts = max(attempts, 1)
+	return func(next Handler) Handler {
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) error {
+			delay := backoff
+			for attempt := 1; ; attempt++ {
+				err := attemptTx(ctx, tx, next, payload)
+				if err == nil || attempt >= attempts || !isTransient(err) {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return errors.Join(err, ctx.Err())
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+		}}
+	}
+}
+
+// attemptTx runs next under a savepoint in tx, releasing it on success and
+// rolling back to it on failure.
+func attemptTx(ctx context.Context, tx pgx.Tx, next Handler, payload []byte) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("savepoint: %w", err)
+	}
+	if err := next.HandleTx(ctx, sp, payload); err != nil {
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("roll back to savepoint: %w", rbErr))
+		}
+		return err
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
+	return nil
+}
+
+// ErrPanic marks the error Recover returns for a handler that panicked.
+var ErrPanic = errors.New("handler panicked")
+
+// Recover turns a handler's panic into an error, logged with its stack.
+//
+// A panic in a consumer worker would otherwise take the whole process down,
+// every other in-flight message with it, and restart into the same message.
+// As an error it goes down the retry policy like any other failure, and a
+// message that panics every time ends up parked instead of crash-looping the
+// subscriber.
+func Recover(log *logger.Logger) Middleware {
+	return func(next Handler) Handler {
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("%w: %s: %v", ErrPanic, next.Name(), p)
+					log.WithFields(logger.Fields{
+						"event_name": next.Name(),
+						"stack":      string(debug.Stack()),
+					}).ErrorWithError("recovered handler panic", err)
+				}
+			}()
+			return next.HandleTx(ctx, tx, payload)
+		}}
+	}
+}
+
+// Tracing runs each message in a span of its own, a child of the consumer's,
+// so the trace that produced an event shows the handler's work and how it
+// ended.
+func Tracing() Middleware {
+	return func(next Handler) Handler {
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) error {
+			attrs := map[string]string{"event_name": next.Name()}
+			if id, err := messageID(payload); err == nil {
+				attrs["message_id"] = id.String()
+			}
+			ctx, end := telemetry.StartSpan(ctx, "handle "+next.Name(), attrs)
+			err := next.HandleTx(ctx, tx, payload)
+			end(err)
+			return err
+		}}
+	}
+}
+
+// Logging logs the outcome of every message with its message_id, event name
+// and duration, so a handler need not log its own failures to be traceable.
+func Logging(log *logger.Logger) Middleware {
+	return func(next Handler) Handler {
+		return wrapped{name: next.Name(), fn: func(ctx context.Context, tx pgx.Tx, payload []byte) error {
+			start := time.Now()
+			err := next.HandleTx(ctx, tx, payload)
+
+			fields := logger.Fields{
+				"event_name":  next.Name(),
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			// A payload without a message_id is logged without one. The
+			// handler is the one that rejects it.
+			if id, idErr := messageID(payload); idErr == nil {
+				fields["message_id"] = id
+			}
+			if err != nil {
+				log.WithFields(fields).ErrorWithError("handle "+next.Name(), err)
+				return err
+			}
+			log.WithFields(fields).Info("handled " + next.Name())
+			return nil
+		}}
+	}
+}
@@ -0,0 +1,23 @@
+-- The inbox: one row per message a consumer group has handled.
+--
+-- handler.Idempotent inserts the row in the same transaction as the handler's
+-- own writes, so the row exists if and only if those writes committed. A
+-- redelivered message collides on the primary key and is skipped, whatever
+-- the handler does — an email, an external call — and whether or not its own
+-- tables have a natural key to collide on.
+--
+-- The key includes the consumer group because every group receives every
+-- message: the analytics projection having handled a message says nothing
+-- about whether the audit projection has.
+CREATE TABLE IF NOT EXISTS processed_messages (
+    consumer_group TEXT        NOT NULL,
+    message_id     UUID        NOT NULL,
+    processed_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (consumer_group, message_id)
+);
+
+-- A row only needs to outlive the longest redelivery window: the outbox
+-- relay's retries plus a replay from a parking queue. This index lets older
+-- rows be pruned by age without a sequential scan.
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at
+    ON processed_messages (processed_at);
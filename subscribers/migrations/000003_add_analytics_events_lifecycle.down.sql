@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_analytics_events_event_id;
+
+ALTER TABLE analytics_events
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS updated_by,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,17 @@
+-- An analytics row follows its event through updates and deletion, rather than
+-- recording only its creation.
+--
+-- updated_at is the occurred_at of the last EventUpdated applied, not the time
+-- it was applied: a handler compares against it to drop an update older than
+-- one already applied. A deleted event keeps its row, with deleted_at set, so
+-- the read model still counts what was created.
+ALTER TABLE analytics_events
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS updated_by TEXT,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by TEXT;
+
+-- Updates and deletions find the row by the event, not by the message that
+-- created it.
+CREATE INDEX IF NOT EXISTS idx_analytics_events_event_id
+    ON analytics_events (event_id);
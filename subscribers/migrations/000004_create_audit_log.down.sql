@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_log_user_id_occurred_at;
+
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,22 @@
+-- The audit projection: one row per security-relevant change to an account —
+-- a signup, a role granted, a password changed.
+--
+-- user_id is the account changed and done_by who changed it, which differ when
+-- an administrator grants a role. payload is the event as it was published, so
+-- a new question about an old change can still be answered.
+--
+-- message_id is the primary key, so a redelivery collides here as it does in
+-- analytics_events.
+CREATE TABLE IF NOT EXISTS audit_log (
+    message_id  UUID        PRIMARY KEY,
+    event       TEXT        NOT NULL,
+    user_id     UUID        NOT NULL,
+    done_by     TEXT        NOT NULL,
+    payload     JSONB       NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- An account's history, newest first.
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id_occurred_at
+    ON audit_log (user_id, occurred_at DESC);
@@ -0,0 +1,297 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"eventify/events"
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/logger"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/stretchr/testify/require"
+)
+
+// quickRetry retries on a delay short enough not to matter to these tests.
+var quickRetry = platformamqp.RetryPolicy{Delays: []time.Duration{time.Second}, MaxDeliveries: 3}
+
+// gate holds every handler that reaches it until it is opened, and keeps
+// count of them.
+type gate struct {
+	mu      sync.Mutex
+	running int
+	most    int
+	started []string
+	done    []string
+	open    chan struct{}
+}
+
+func newGate() *gate { return &gate{open: make(chan struct{})} }
+
+// handle waits at the gate, and returns ctx's error if ctx ends first.
+func (g *gate) handle(ctx context.Context, d platformamqp.Delivery) error {
+	g.mu.Lock()
+	g.running++
+	g.most = max(g.most, g.running)
+	g.started = append(g.started, d.MessageID)
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.running--
+		g.mu.Unlock()
+	}()
+
+	select {
+	case <-g.open:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	g.mu.Lock()
+	g.done = append(g.done, d.MessageID)
+	g.mu.Unlock()
+	return nil
+}
+
+// snapshot is how many handlers are running, the most there have been at once,
+// and which messages handlers started on and finished.
+func (g *gate) snapshot() (running, most int, started, done []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.running, g.most, append([]string(nil), g.started...), append([]string(nil), g.done...)
+}
+
+// waitRunning waits until n handlers are held at the gate, then gives the
+// consumer time to start more, which it must not.
+func (g *gate) waitRunning(t *testing.T, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		running, _, _, _ := g.snapshot()
+		return running == n
+	}, 30*time.Second, 20*time.Millisecond, "want %d handlers running", n)
+	time.Sleep(500 * time.Millisecond)
+	running, most, _, _ := g.snapshot()
+	require.Equal(t, n, running)
+	require.Equal(t, n, most)
+}
+
+// waitDone waits until handlers have finished n messages.
+func (g *gate) waitDone(t *testing.T, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		_, _, _, done := g.snapshot()
+		return len(done) == n
+	}, 30*time.Second, 20*time.Millisecond, "want %d messages handled", n)
+}
+
+func publishN(t *testing.T, uri, key string, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = testsupport.Publish(t, uri, key, []byte(`{}`))
+	}
+	return ids
+}
+
+// remaining takes every message waiting in queue and returns their IDs.
+func remaining(t *testing.T, uri, queue string) []string {
+	t.Helper()
+	ch := testsupport.Channel(t, uri)
+	var ids []string
+	for {
+		d, ok, err := ch.Get(queue, true)
+		require.NoError(t, err)
+		if !ok {
+			return ids
+		}
+		ids = append(ids, d.MessageId)
+	}
+}
+
+// WithWorkers is a ceiling as well as a floor: that many handlers run at once
+// while messages wait, and never one more.
+func TestIntegrationConsumer_RunsAsManyHandlersAsItHasWorkers(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+
+	c := platformamqp.NewConsumer(uri, testsupport.Group(), []string{routingKey}, quickRetry, logger.New(false),
+		platformamqp.WithWorkers(3))
+	g := newGate()
+	testsupport.RunConsumer(t, c, g.handle)
+	publishN(t, uri, routingKey, 6)
+
+	g.waitRunning(t, 3)
+	close(g.open)
+	g.waitDone(t, 6)
+	_, most, _, _ := g.snapshot()
+	require.Equal(t, 3, most)
+}
+
+// A pool's workers are its own: an event whose handler is stuck holds up its
+// own messages and no one else's, and no more of its handlers run than its
+// pool has workers.
+func TestIntegrationConsumer_APoolKeepsASlowEventFromTheRest(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+
+	created := events.RoutingKey(events.EventCreatedName)
+	deleted := events.RoutingKey(events.EventDeletedName)
+	poolOf := func(d platformamqp.Delivery) string {
+		name, _ := events.NameFromRoutingKey(d.RoutingKey)
+		return name
+	}
+	c := platformamqp.NewConsumer(uri, testsupport.Group(), []string{created, deleted}, quickRetry, logger.New(false),
+		platformamqp.WithWorkers(1),
+		platformamqp.WithPools(poolOf, map[string]int{events.EventCreatedName: 2}))
+
+	stuck := newGate()
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	testsupport.RunConsumer(t, c, func(ctx context.Context, d platformamqp.Delivery) error {
+		if d.RoutingKey == created {
+			return stuck.handle(ctx, d)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, d.MessageID)
+		return nil
+	})
+
+	publishN(t, uri, created, 4)
+	stuck.waitRunning(t, 2)
+	others := publishN(t, uri, deleted, 3)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == len(others)
+	}, 30*time.Second, 20*time.Millisecond, "the shared pool waited on a stuck one")
+	mu.Lock()
+	require.Equal(t, others, handled, "one worker handles its pool's messages in order")
+	mu.Unlock()
+
+	close(stuck.open)
+	stuck.waitDone(t, 4)
+	_, most, _, _ := stuck.snapshot()
+	require.Equal(t, 2, most)
+}
+
+// The broker sends a consumer no more unacked messages than its prefetch; the
+// rest wait in the queue, where another replica could take them.
+func TestIntegrationConsumer_PrefetchBoundsWhatTheBrokerSendsAhead(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	group := testsupport.Group()
+
+	c := platformamqp.NewConsumer(uri, group, []string{routingKey}, quickRetry, logger.New(false),
+		platformamqp.WithPrefetch(2))
+	g := newGate()
+	testsupport.RunConsumer(t, c, g.handle)
+	publishN(t, uri, routingKey, 5)
+
+	g.waitRunning(t, 1)
+	ch := testsupport.Channel(t, uri)
+	require.Eventually(t, func() bool { return testsupport.Depth(t, ch, group) == 3 },
+		10*time.Second, 50*time.Millisecond, "one handled and one prefetched; three left in the queue")
+	close(g.open)
+	g.waitDone(t, 5)
+}
+
+// A prefetch below the worker count, every pool's counted, is raised to it, or
+// the workers past the prefetch would never be sent a message.
+func TestIntegrationConsumer_PrefetchIsRaisedToTheWorkers(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+
+	c := platformamqp.NewConsumer(uri, testsupport.Group(), []string{routingKey}, quickRetry, logger.New(false),
+		platformamqp.WithPools(func(platformamqp.Delivery) string { return "all" }, map[string]int{"all": 2}),
+		platformamqp.WithPrefetch(1))
+	g := newGate()
+	testsupport.RunConsumer(t, c, g.handle)
+	publishN(t, uri, routingKey, 4)
+
+	g.waitRunning(t, 2)
+	close(g.open)
+	g.waitDone(t, 4)
+}
+
+// Stopping a consumer stops it taking messages, lets the handler already
+// running finish and acks its message, and hands back the ones it had
+// prefetched but not started. Run returns only after all that.
+func TestIntegrationConsumer_ShutdownFinishesTheHandlersInFlight(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	group := testsupport.Group()
+
+	c := platformamqp.NewConsumer(uri, group, []string{routingKey}, quickRetry, logger.New(false),
+		platformamqp.WithPrefetch(3),
+		platformamqp.WithShutdownTimeout(time.Minute))
+	g := newGate()
+	stop := testsupport.RunConsumer(t, c, g.handle)
+	ids := publishN(t, uri, routingKey, 3)
+	g.waitRunning(t, 1)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Run returned with a handler still running: %v", err)
+	case <-time.After(time.Second):
+	}
+
+	late := testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+	close(g.open)
+	select {
+	case err := <-stopped:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(30 * time.Second):
+		t.Fatal("Run did not return once its handler finished")
+	}
+
+	_, _, started, done := g.snapshot()
+	require.Equal(t, ids[:1], started, "no handler starts once shutdown begins")
+	require.Equal(t, ids[:1], done)
+	require.ElementsMatch(t, append(ids[1:], late), remaining(t, uri, group),
+		"the finished message was acked; the rest wait in the queue")
+}
+
+// A handler that outlasts the shutdown timeout has its context cancelled, and
+// its message goes back on the queue as it was: not retried, not parked, and
+// not lost.
+func TestIntegrationConsumer_ShutdownRequeuesHandlersPastTheTimeout(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	group := testsupport.Group()
+
+	const timeout = 500 * time.Millisecond
+	c := platformamqp.NewConsumer(uri, group, []string{routingKey}, quickRetry, logger.New(false),
+		platformamqp.WithShutdownTimeout(timeout))
+	cancelled := make(chan error, 1)
+	running := make(chan struct{})
+	stop := testsupport.RunConsumer(t, c, func(ctx context.Context, _ platformamqp.Delivery) error {
+		close(running)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return ctx.Err()
+	})
+	id := testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+	<-running
+
+	began := time.Now()
+	require.ErrorIs(t, stop(), context.Canceled)
+	require.GreaterOrEqual(t, time.Since(began), timeout, "Run waited out the timeout first")
+	require.True(t, errors.Is(<-cancelled, context.Canceled), "the handler's context was cancelled")
+
+	ch := testsupport.Channel(t, uri)
+	require.Zero(t, testsupport.Depth(t, ch, platformamqp.RetryQueueName(group, quickRetry.Delays[0])))
+	require.Zero(t, testsupport.Depth(t, ch, platformamqp.ParkingQueueName(group)))
+	d, ok, err := ch.Get(group, true)
+	require.NoError(t, err)
+	require.True(t, ok, "the message went back on the queue")
+	require.Equal(t, id, d.MessageId)
+	require.True(t, d.Redelivered)
+	require.Equal(t, 1, platformamqp.Deliveries(d.Headers, group), "requeueing is not a retry")
+}
@@ -0,0 +1,121 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/logger"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/stretchr/testify/require"
+)
+
+const routingKey = "eventify.events.EventCreated"
+
+// call is one time the handler ran.
+type call struct {
+	at         time.Time
+	deliveries int
+}
+
+// A handler that never succeeds must see its message once per delivery, each
+// after the delay of the tier it reached, and after MaxDeliveries find it
+// parked with the error that put it there — never a fourth time.
+//
+// The delivery count crosses each retry on the message's headers, so this is
+// also the test that the broker and the consumer between them keep it.
+func TestIntegrationConsumer_RetriesThroughEachTierThenParks(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	g := testsupport.Group()
+
+	policy := platformamqp.RetryPolicy{Delays: []time.Duration{time.Second, 2 * time.Second}, MaxDeliveries: 3}
+	c := platformamqp.NewConsumer(uri, g, []string{routingKey}, policy, logger.New(false))
+
+	calls := make(chan call, 10)
+	testsupport.RunConsumer(t, c, func(_ context.Context, d platformamqp.Delivery) error {
+		calls <- call{at: time.Now(), deliveries: d.Deliveries}
+		return errors.New("projection failed")
+	})
+	id := testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+
+	var got []call
+	for len(got) < policy.MaxDeliveries {
+		select {
+		case c := <-calls:
+			got = append(got, c)
+		case <-time.After(30 * time.Second):
+			t.Fatalf("handler ran %d time(s), want %d", len(got), policy.MaxDeliveries)
+		}
+	}
+	for i, c := range got {
+		require.Equal(t, i+1, c.deliveries, "delivery %d", i+1)
+	}
+	// A tier's TTL is a floor, not an exact wait: the broker expires messages
+	// from the head of the queue when it gets to them.
+	require.GreaterOrEqual(t, got[1].at.Sub(got[0].at), policy.Delays[0]-100*time.Millisecond)
+	require.GreaterOrEqual(t, got[2].at.Sub(got[1].at), policy.Delays[1]-100*time.Millisecond)
+
+	ch := testsupport.Channel(t, uri)
+	parked := platformamqp.ParkingQueueName(g)
+	require.Eventually(t, func() bool { return testsupport.Depth(t, ch, parked) == 1 }, 10*time.Second, 50*time.Millisecond)
+
+	d, ok, err := ch.Get(parked, true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, id, d.MessageId)
+	require.Equal(t, "projection failed", d.Headers[platformamqp.ErrorHeader])
+	require.Equal(t, routingKey, d.Headers[platformamqp.RoutingKeyHeader])
+	require.Equal(t, routingKey, platformamqp.OriginalRoutingKey(d.Headers, d.RoutingKey))
+
+	select {
+	case c := <-calls:
+		t.Fatalf("a parked message was delivered again, as delivery %d", c.deliveries)
+	case <-time.After(policy.Delays[len(policy.Delays)-1] + time.Second):
+	}
+	for _, delay := range policy.Delays {
+		require.Zero(t, testsupport.Depth(t, ch, platformamqp.RetryQueueName(g, delay)), "nothing is left waiting in a tier")
+	}
+	require.Zero(t, testsupport.Depth(t, ch, g))
+}
+
+// A message that succeeds on a retry is acked there, and goes no further.
+func TestIntegrationConsumer_AcksAMessageThatSucceedsOnARetry(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	g := testsupport.Group()
+
+	policy := platformamqp.RetryPolicy{Delays: []time.Duration{time.Second}, MaxDeliveries: 3}
+	c := platformamqp.NewConsumer(uri, g, []string{routingKey}, policy, logger.New(false))
+
+	calls := make(chan int, 10)
+	testsupport.RunConsumer(t, c, func(_ context.Context, d platformamqp.Delivery) error {
+		calls <- d.Deliveries
+		if d.Deliveries == 1 {
+			return errors.New("dependency restarting")
+		}
+		return nil
+	})
+	testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+
+	for want := 1; want <= 2; want++ {
+		select {
+		case got := <-calls:
+			require.Equal(t, want, got)
+		case <-time.After(30 * time.Second):
+			t.Fatalf("delivery %d never arrived", want)
+		}
+	}
+
+	ch := testsupport.Channel(t, uri)
+	select {
+	case n := <-calls:
+		t.Fatalf("an acked message was delivered again, as delivery %d", n)
+	case <-time.After(2 * time.Second):
+	}
+	require.Zero(t, testsupport.Depth(t, ch, platformamqp.ParkingQueueName(g)))
+	require.Zero(t, testsupport.Depth(t, ch, g))
+}
@@ -0,0 +1,181 @@
+package dlq_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"eventify/events"
+	platformamqp "eventify/platform/amqp"
+	"eventify/platform/cli"
+	"eventify/platform/logger"
+	"eventify/subscribers/internal/dlq"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+var routingKey = events.RoutingKey(events.EventCreatedName)
+
+// parkOnFailure starts a consumer for group that parks a message the first
+// time its handler fails, and fails while failing is set. Every delivery it
+// sees, failed or not, goes to the returned channel.
+func parkOnFailure(t *testing.T, uri, group string, failing *atomic.Bool) <-chan platformamqp.Delivery {
+	t.Helper()
+	c := platformamqp.NewConsumer(uri, group, []string{routingKey},
+		platformamqp.RetryPolicy{MaxDeliveries: 1}, logger.New(false))
+
+	seen := make(chan platformamqp.Delivery, 10)
+	testsupport.RunConsumer(t, c, func(_ context.Context, d platformamqp.Delivery) error {
+		seen <- d
+		if failing.Load() {
+			return errors.New("projection failed")
+		}
+		return nil
+	})
+	return seen
+}
+
+// next is the next delivery the consumer saw.
+func next(t *testing.T, seen <-chan platformamqp.Delivery) platformamqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-seen:
+		return d
+	case <-time.After(30 * time.Second):
+		t.Fatal("no delivery arrived")
+		return platformamqp.Delivery{}
+	}
+}
+
+// parked waits until n messages wait in group's parking queue.
+func parked(t *testing.T, uri, group string, n int) {
+	t.Helper()
+	ch := testsupport.Channel(t, uri)
+	require.Eventually(t, func() bool {
+		return testsupport.Depth(t, ch, platformamqp.ParkingQueueName(group)) == n
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func ids(ps []platformamqp.Parked) []string {
+	out := make([]string, len(ps))
+	for i, p := range ps {
+		out[i] = p.MessageId
+	}
+	return out
+}
+
+// A parked message, once its cause is fixed, is replayed under the routing key
+// it was first published with and consumed as a fresh delivery: the first of
+// a new retry budget. A dry run before that changes nothing.
+func TestIntegrationReplay_RedeliversAParkedMessage(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	group := testsupport.Group()
+	ctx := context.Background()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	seen := parkOnFailure(t, uri, group, &failing)
+	id := testsupport.Publish(t, uri, routingKey, []byte(`{"n":1}`))
+	require.Equal(t, id, next(t, seen).MessageID)
+	parked(t, uri, group, 1)
+
+	sel := dlq.Selection{Type: events.EventCreatedName}
+	done, err := dlq.Replay(ctx, uri, group, sel, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{id}, ids(done))
+	require.Equal(t, "projection failed", done[0].Failure())
+	require.Equal(t, routingKey, done[0].RoutingKey)
+	parked(t, uri, group, 1)
+
+	failing.Store(false)
+	pub, err := platformamqp.NewPublisher(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pub.Close() })
+
+	done, err = dlq.Replay(ctx, uri, group, sel, pub, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{id}, ids(done))
+
+	d := next(t, seen)
+	require.Equal(t, id, d.MessageID)
+	require.Equal(t, routingKey, d.RoutingKey)
+	require.Equal(t, 1, d.Deliveries, "a replayed message starts a new retry budget")
+	require.JSONEq(t, `{"n":1}`, string(d.Body))
+	require.Empty(t, d.Headers[platformamqp.ErrorHeader])
+	parked(t, uri, group, 0)
+}
+
+// Only the selected messages leave the parking queue; the rest go back to it.
+func TestIntegrationDiscard_TakesOnlyTheSelectedMessages(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	uri := testsupport.Broker(t)
+	group := testsupport.Group()
+	ctx := context.Background()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	seen := parkOnFailure(t, uri, group, &failing)
+	keep := testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+	drop := testsupport.Publish(t, uri, routingKey, []byte(`{}`))
+	next(t, seen)
+	next(t, seen)
+	parked(t, uri, group, 2)
+
+	done, err := dlq.Discard(ctx, uri, group, dlq.Selection{IDs: []string{drop}}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{drop}, ids(done))
+	parked(t, uri, group, 1)
+
+	var left []string
+	require.NoError(t, platformamqp.WalkParked(ctx, uri, group, 0, func(p platformamqp.Parked) error {
+		left = append(left, p.MessageId)
+		return nil
+	}))
+	require.Equal(t, []string{keep}, left)
+	parked(t, uri, group, 1)
+}
+
+// A selection that names nothing is refused before the queue is touched.
+func TestSelection_RefusesToSelectEverythingByOmission(t *testing.T) {
+	_, err := dlq.Discard(context.Background(), "amqp://unreachable", "eventify.test", dlq.Selection{}, false)
+	require.ErrorIs(t, err, cli.ErrUsage)
+
+	require.NoError(t, dlq.Selection{All: true}.Check())
+	require.NoError(t, dlq.Selection{Type: events.EventCreatedName}.Check())
+}
+
+func TestSelection_Matches(t *testing.T) {
+	created := platformamqp.Parked{RoutingKey: routingKey}
+	created.MessageId = "a"
+	deleted := platformamqp.Parked{RoutingKey: events.RoutingKey(events.EventDeletedName)}
+	deleted.MessageId = "b"
+
+	require.True(t, dlq.Selection{All: true}.Matches(created))
+	require.True(t, dlq.Selection{All: true}.Matches(deleted))
+
+	byType := dlq.Selection{Type: events.EventCreatedName}
+	require.True(t, byType.Matches(created))
+	require.False(t, byType.Matches(deleted))
+
+	byID := dlq.Selection{IDs: []string{"b", "c"}}
+	require.False(t, byID.Matches(created))
+	require.True(t, byID.Matches(deleted))
+
+	require.False(t, dlq.Selection{IDs: []string{"b"}, Type: events.EventCreatedName}.Matches(deleted),
+		"a message must match every filter given")
+}
+
+// The envelope names the event the producer sent; a routing key is only where
+// it was sent, which a bridge or a wildcard binding can change.
+func TestSelection_MatchesOnTheEnvelopeName(t *testing.T) {
+	p := platformamqp.Parked{RoutingKey: routingKey}
+	p.Headers = amqp.Table{events.HeaderName: events.EventDeletedName}
+
+	require.True(t, dlq.Selection{Type: events.EventDeletedName}.Matches(p))
+	require.False(t, dlq.Selection{Type: events.EventCreatedName}.Matches(p))
+}
@@ -0,0 +1,90 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/platform/logger"
+	"eventify/subscribers/internal/handler"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationAudit_RecordsEachLifecycleEventOnce(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	log := logger.New(false)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	user, admin := uuid.New(), uuid.New()
+	signedUp := events.UserSignedUp{
+		MessageID: uuid.New(), UserID: user, Email: "a@example.com", OccurredAt: now,
+	}
+	assigned := events.RoleAssigned{
+		MessageID: uuid.New(), UserID: user, RoleID: uuid.New(), RoleName: "admin",
+		DoneBy: admin.String(), OccurredAt: now.Add(time.Minute),
+	}
+	changed := events.PasswordChanged{
+		MessageID: uuid.New(), UserID: user, DoneBy: user.String(), OccurredAt: now.Add(2 * time.Minute),
+	}
+
+	for _, c := range []struct {
+		h    handler.Handler
+		body []byte
+	}{
+		{handler.NewUserSignedUpAudit(log), marshal(t, signedUp)},
+		{handler.NewRoleAssignedAudit(log), marshal(t, assigned)},
+		{handler.NewPasswordChangedAudit(log), marshal(t, changed)},
+	} {
+		require.NoError(t, handle(t, pool, c.h, c.body))
+		require.NoError(t, handle(t, pool, c.h, c.body), "redelivery must not error")
+	}
+
+	rows, err := pool.Query(context.Background(),
+		`SELECT event, done_by FROM audit_log WHERE user_id = $1 ORDER BY occurred_at`, user)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var got [][2]string
+	for rows.Next() {
+		var event, doneBy string
+		require.NoError(t, rows.Scan(&event, &doneBy))
+		got = append(got, [2]string{event, doneBy})
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, [][2]string{
+		{events.UserSignedUpName, user.String()},
+		{events.RoleAssignedName, admin.String()},
+		{events.PasswordChangedName, user.String()},
+	}, got)
+}
+
+func TestIntegrationAudit_KeepsThePayload(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	evt := events.RoleAssigned{
+		MessageID: uuid.New(), UserID: uuid.New(), RoleID: uuid.New(), RoleName: "event_manager",
+		DoneBy: uuid.NewString(), OccurredAt: time.Now().UTC(),
+	}
+	require.NoError(t, handle(t, pool, handler.NewRoleAssignedAudit(logger.New(false)), marshal(t, evt)))
+
+	var roleName string
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT payload->>'role_name' FROM audit_log WHERE message_id = $1`, evt.MessageID).Scan(&roleName))
+	require.Equal(t, "event_manager", roleName)
+}
+
+func TestIntegrationAudit_RejectsAPayloadWithoutAMessageID(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	body := marshal(t, events.PasswordChanged{UserID: uuid.New(), OccurredAt: time.Now()})
+	err := handle(t, pool, handler.NewPasswordChangedAudit(logger.New(false)), body)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "message_id")
+}
@@ -36,6 +36,15 @@ func sampleEvent(messageID uuid.UUID) events.EventCreated {
 	}
 }
 
+// handle runs h the way the subscriber does: through a Registry, in a
+// transaction committed only if h succeeds.
+func handle(t *testing.T, pool *pgxpool.Pool, h handler.Handler, body []byte) error {
+	t.Helper()
+	r, err := handler.NewRegistry(pool, h)
+	require.NoError(t, err)
+	return r.Dispatch(context.Background(), h.Name(), body)
+}
+
 func countFor(t *testing.T, pool *pgxpool.Pool, messageID uuid.UUID) int {
 	t.Helper()
 	var n int
@@ -51,14 +60,13 @@ func countFor(t *testing.T, pool *pgxpool.Pool, messageID uuid.UUID) int {
 func TestIntegrationEventCreated_IsIdempotentOnMessageID(t *testing.T) {
 	testsupport.SkipUnlessDocker(t)
 	pool := testsupport.Pool(t)
-	ctx := context.Background()
 
-	h := handler.NewEventCreated(pool, logger.New(false))
+	h := handler.NewEventCreated(logger.New(false))
 	messageID := uuid.New()
 	body := payloadFor(t, sampleEvent(messageID))
 
-	require.NoError(t, h.Handle(ctx, body))
-	require.NoError(t, h.Handle(ctx, body), "redelivery must not error")
+	require.NoError(t, handle(t, pool, h, body))
+	require.NoError(t, handle(t, pool, h, body), "redelivery must not error")
 
 	require.Equal(t, 1, countFor(t, pool, messageID), "redelivery must not insert a second row")
 }
@@ -68,11 +76,11 @@ func TestIntegrationEventCreated_PersistsThePayload(t *testing.T) {
 	pool := testsupport.Pool(t)
 	ctx := context.Background()
 
-	h := handler.NewEventCreated(pool, logger.New(false))
+	h := handler.NewEventCreated(logger.New(false))
 	messageID := uuid.New()
 	evt := sampleEvent(messageID)
 
-	require.NoError(t, h.Handle(ctx, payloadFor(t, evt)))
+	require.NoError(t, handle(t, pool, h, payloadFor(t, evt)))
 
 	var (
 		eventID                 uuid.UUID
@@ -94,13 +102,12 @@ func TestIntegrationEventCreated_PersistsThePayload(t *testing.T) {
 func TestIntegrationEventCreated_RejectsAMalformedPayload(t *testing.T) {
 	testsupport.SkipUnlessDocker(t)
 	pool := testsupport.Pool(t)
-	ctx := context.Background()
 
-	h := handler.NewEventCreated(pool, logger.New(false))
+	h := handler.NewEventCreated(logger.New(false))
 
 	// It must return an error so the subscriber nacks. The old consumer logged
 	// the failure and acked anyway, silently discarding the event.
-	require.Error(t, h.Handle(ctx, []byte(`{"not":`)))
+	require.Error(t, handle(t, pool, h, []byte(`{"not":`)))
 }
 
 // Deduplication is only as good as the key. A payload with no message_id would
@@ -109,20 +116,19 @@ func TestIntegrationEventCreated_RejectsAMalformedPayload(t *testing.T) {
 func TestIntegrationEventCreated_RejectsAPayloadWithoutAMessageID(t *testing.T) {
 	testsupport.SkipUnlessDocker(t)
 	pool := testsupport.Pool(t)
-	ctx := context.Background()
 
-	h := handler.NewEventCreated(pool, logger.New(false))
+	h := handler.NewEventCreated(logger.New(false))
 	evt := sampleEvent(uuid.Nil)
 
-	err := h.Handle(ctx, payloadFor(t, evt))
+	err := handle(t, pool, h, payloadFor(t, evt))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "message_id")
 }
 
 // Dispatch resolves an event name to a handler. An unknown name must be an
-// error, not a silent drop, so the message lands in the dead-letter queue.
+// error, not a silent drop, so the message is retried and then parked.
 func TestRegistry_DispatchRejectsAnUnknownEvent(t *testing.T) {
-	r, err := handler.NewRegistry()
+	r, err := handler.NewRegistry(nil)
 	require.NoError(t, err)
 
 	err = r.Dispatch(context.Background(), "Ghost", []byte(`{}`))
@@ -130,18 +136,64 @@ func TestRegistry_DispatchRejectsAnUnknownEvent(t *testing.T) {
 	require.Contains(t, err.Error(), "no handler registered")
 }
 
+// The envelope is what the producer said it sent; the name passed in was only
+// inferred from a routing key, which a bridge or a wildcard binding can change.
+func TestRegistry_DispatchRoutesOnTheEnvelope(t *testing.T) {
+	r, err := handler.NewRegistry(nil, handler.NewEventCreated(logger.New(false)))
+	require.NoError(t, err)
+
+	ctx := events.WithEnvelope(context.Background(), &events.Envelope{Name: "Ghost"})
+	err = r.Dispatch(ctx, events.EventCreatedName, []byte(`{}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no handler registered for Ghost")
+}
+
+// A payload from a producer that knows a newer version of the contract cannot
+// be read here. It must fail, to be retried once this binary catches up, not
+// be decoded as the older shape.
+func TestRegistry_DispatchRejectsAVersionNewerThanItReads(t *testing.T) {
+	r, err := handler.NewRegistry(nil, handler.NewEventCreated(logger.New(false)))
+	require.NoError(t, err)
+
+	env := &events.Envelope{Name: events.EventCreatedName, Version: events.Version(events.EventCreatedName) + 1}
+	err = r.Dispatch(events.WithEnvelope(context.Background(), env), events.EventCreatedName, []byte(`{}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "this binary reads up to version")
+}
+
+// Dispatch commits a handler's writes only if it succeeds. A projection that
+// fails halfway must leave nothing behind for its redelivery to trip over.
+func TestIntegrationRegistry_RollsBackAFailedHandler(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	messageID := uuid.New()
+	err := handle(t, pool, failAfter{handler.NewEventCreated(logger.New(false))}, payloadFor(t, sampleEvent(messageID)))
+	require.Error(t, err)
+	require.Zero(t, countFor(t, pool, messageID), "the first write must roll back with the failure")
+}
+
 func TestRegistry_RejectsDuplicateHandlers(t *testing.T) {
-	h := handler.NewEventCreated(nil, logger.New(false))
+	h := handler.NewEventCreated(logger.New(false))
 
-	_, err := handler.NewRegistry(h, h)
+	_, err := handler.NewRegistry(nil, h, h)
 	require.Error(t, err, "two handlers for one event name is a wiring bug")
 	require.Contains(t, err.Error(), "duplicate handler")
 }
 
 func TestRegistry_RoutingKeysCoverEveryHandler(t *testing.T) {
-	r, err := handler.NewRegistry(handler.NewEventCreated(nil, logger.New(false)))
+	r, err := handler.NewRegistry(nil, handler.NewEventCreated(logger.New(false)))
 	require.NoError(t, err)
 
 	require.Equal(t, []string{events.RoutingKey(events.EventCreatedName)}, r.RoutingKeys())
 	require.Equal(t, []string{events.EventCreatedName}, r.Names())
 }
+
+func TestRegistry_HandlesOnlyRegisteredNames(t *testing.T) {
+	r, err := handler.NewRegistry(nil, handler.NewEventCreated(logger.New(false)))
+	require.NoError(t, err)
+
+	require.True(t, r.Handles(events.EventCreatedName))
+	require.False(t, r.Handles(events.EventDeletedName))
+	require.False(t, r.Handles("Attacker-"+uuid.NewString()))
+}
@@ -0,0 +1,106 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"eventify/events"
+	"eventify/platform/logger"
+	"eventify/subscribers/internal/handler"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func marshal(t *testing.T, v any) []byte {
+	t.Helper()
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	return body
+}
+
+// created projects a sample EventCreated and returns it.
+func created(t *testing.T, pool *pgxpool.Pool) events.EventCreated {
+	t.Helper()
+	evt := sampleEvent(uuid.New())
+	require.NoError(t, handle(t, pool, handler.NewEventCreated(logger.New(false)), payloadFor(t, evt)))
+	return evt
+}
+
+func updatedFor(evt events.EventCreated, name string, at time.Time) events.EventUpdated {
+	return events.EventUpdated{
+		MessageID: uuid.New(), ID: evt.ID, Name: name, Type: evt.Type,
+		ChangedFields: []string{"name"}, DoneBy: uuid.NewString(), OccurredAt: at,
+	}
+}
+
+type analyticsRow struct {
+	name      string
+	updatedBy *string
+	deletedAt *time.Time
+	deletedBy *string
+}
+
+func rowFor(t *testing.T, pool *pgxpool.Pool, eventID uuid.UUID) analyticsRow {
+	t.Helper()
+	var r analyticsRow
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT name, updated_by, deleted_at, deleted_by FROM analytics_events WHERE event_id = $1`, eventID).
+		Scan(&r.name, &r.updatedBy, &r.deletedAt, &r.deletedBy))
+	return r
+}
+
+func TestIntegrationEventUpdated_AppliesTheNewestUpdate(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	h := handler.NewEventUpdated(logger.New(false))
+	evt := created(t, pool)
+
+	newer := updatedFor(evt, "Renamed", evt.OccurredAt.Add(2*time.Minute))
+	require.NoError(t, handle(t, pool, h, marshal(t, newer)))
+	got := rowFor(t, pool, evt.ID)
+	require.Equal(t, "Renamed", got.name)
+	require.Equal(t, newer.DoneBy, *got.updatedBy)
+
+	// An older update arriving late — on another worker, or after a retry —
+	// must not undo the newer one.
+	older := updatedFor(evt, "Stale", evt.OccurredAt.Add(time.Minute))
+	require.NoError(t, handle(t, pool, h, marshal(t, older)))
+	require.Equal(t, "Renamed", rowFor(t, pool, evt.ID).name)
+}
+
+// An update that overtook its event's creation goes back to be retried,
+// rather than being dropped on the floor.
+func TestIntegrationEventUpdated_RetriesAnEventNotProjectedYet(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	early := updatedFor(sampleEvent(uuid.New()), "Early", time.Now())
+	err := handle(t, pool, handler.NewEventUpdated(logger.New(false)), marshal(t, early))
+	require.ErrorIs(t, err, handler.ErrNotProjected)
+}
+
+func TestIntegrationEventDeleted_MarksTheRowAndStopsUpdates(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	evt := created(t, pool)
+
+	deleted := events.EventDeleted{
+		MessageID: uuid.New(), ID: evt.ID, DoneBy: uuid.NewString(), OccurredAt: evt.OccurredAt.Add(time.Minute),
+	}
+	del := handler.NewEventDeleted(logger.New(false))
+	require.NoError(t, handle(t, pool, del, marshal(t, deleted)))
+	require.NoError(t, handle(t, pool, del, marshal(t, deleted)), "a duplicate deletion is a no-op")
+
+	got := rowFor(t, pool, evt.ID)
+	require.NotNil(t, got.deletedAt, "the row stays, marked deleted")
+	require.Equal(t, deleted.DoneBy, *got.deletedBy)
+
+	late := updatedFor(evt, "After deletion", evt.OccurredAt.Add(2*time.Minute))
+	require.NoError(t, handle(t, pool, handler.NewEventUpdated(logger.New(false)), marshal(t, late)))
+	require.Equal(t, evt.Name, rowFor(t, pool, evt.ID).name, "a deleted event takes no updates")
+}
@@ -0,0 +1,135 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"eventify/platform/logger"
+	"eventify/subscribers/internal/handler"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// sideEffect is a handler with no natural deduplication key: every call it is
+// allowed to finish counts, and it fails while err is set.
+type sideEffect struct {
+	calls int
+	err   error
+}
+
+func (s *sideEffect) Name() string { return "SideEffect" }
+
+func (s *sideEffect) HandleTx(context.Context, pgx.Tx, []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.calls++
+	return nil
+}
+
+func processedCount(t *testing.T, pool *pgxpool.Pool, group string, messageID uuid.UUID) int {
+	t.Helper()
+	var n int
+	require.NoError(t, pool.QueryRow(context.Background(),
+		`SELECT count(*) FROM processed_messages WHERE consumer_group = $1 AND message_id = $2`,
+		group, messageID).Scan(&n))
+	return n
+}
+
+func TestIntegrationIdempotent_SkipsARedeliveredMessage(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &sideEffect{}
+	h := handler.NewIdempotent("eventify.test", inner, logger.New(false))
+	body := payloadFor(t, sampleEvent(uuid.New()))
+
+	require.NoError(t, handle(t, pool, h, body))
+	require.NoError(t, handle(t, pool, h, body), "a duplicate is skipped, not an error")
+
+	require.Equal(t, 1, inner.calls)
+}
+
+// The inbox row must commit only with the handler's success. Were it written
+// first, on its own, a handler that failed once would be skipped forever after.
+func TestIntegrationIdempotent_HandlesAFailedMessageAgain(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &sideEffect{err: errors.New("smtp unavailable")}
+	h := handler.NewIdempotent("eventify.test", inner, logger.New(false))
+	messageID := uuid.New()
+	body := payloadFor(t, sampleEvent(messageID))
+
+	require.Error(t, handle(t, pool, h, body))
+	require.Zero(t, processedCount(t, pool, "eventify.test", messageID), "a failure must roll back the inbox row")
+
+	inner.err = nil
+	require.NoError(t, handle(t, pool, h, body))
+	require.Equal(t, 1, inner.calls)
+	require.Equal(t, 1, processedCount(t, pool, "eventify.test", messageID))
+}
+
+// Every consumer group receives every message, and each must handle it once.
+func TestIntegrationIdempotent_KeysOnTheConsumerGroup(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	analytics, audit := &sideEffect{}, &sideEffect{}
+	body := payloadFor(t, sampleEvent(uuid.New()))
+
+	require.NoError(t, handle(t, pool, handler.NewIdempotent("eventify.analytics", analytics, logger.New(false)), body))
+	require.NoError(t, handle(t, pool, handler.NewIdempotent("eventify.audit", audit, logger.New(false)), body))
+
+	require.Equal(t, 1, analytics.calls)
+	require.Equal(t, 1, audit.calls)
+}
+
+// failAfter runs a real projection and then fails, as a handler writing two
+// rows would if the second insert failed.
+type failAfter struct{ *handler.EventCreated }
+
+func (f failAfter) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	if err := f.EventCreated.HandleTx(ctx, tx, payload); err != nil {
+		return err
+	}
+	return errors.New("second write failed")
+}
+
+// The handler's writes and the inbox row share a transaction: they commit
+// together, and a handler that fails after writing leaves neither behind.
+func TestIntegrationIdempotent_CommitsWithTheHandlersWrites(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+	log := logger.New(false)
+
+	failed := uuid.New()
+	h := handler.NewIdempotent("eventify.test", failAfter{handler.NewEventCreated(log)}, log)
+	require.Error(t, handle(t, pool, h, payloadFor(t, sampleEvent(failed))))
+	require.Zero(t, countFor(t, pool, failed))
+	require.Zero(t, processedCount(t, pool, "eventify.test", failed))
+
+	committed := uuid.New()
+	h = handler.NewIdempotent("eventify.test", handler.NewEventCreated(log), log)
+	require.NoError(t, handle(t, pool, h, payloadFor(t, sampleEvent(committed))))
+	require.Equal(t, 1, countFor(t, pool, committed))
+	require.Equal(t, 1, processedCount(t, pool, "eventify.test", committed))
+}
+
+func TestIntegrationIdempotent_RejectsAPayloadWithoutAMessageID(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &sideEffect{}
+	h := handler.NewIdempotent("eventify.test", inner, logger.New(false))
+
+	err := handle(t, pool, h, payloadFor(t, sampleEvent(uuid.Nil)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "message_id")
+	require.Zero(t, inner.calls)
+}
@@ -0,0 +1,139 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"eventify/platform/logger"
+	"eventify/subscribers/internal/handler"
+	"eventify/subscribers/tests/integration/testsupport"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// scripted is a handler that returns errs in turn, one per call, then nil.
+type scripted struct {
+	calls int
+	errs  []error
+	seen  func(ctx context.Context)
+}
+
+func (s *scripted) Name() string { return "Scripted" }
+
+func (s *scripted) HandleTx(ctx context.Context, _ pgx.Tx, _ []byte) error {
+	s.calls++
+	if s.seen != nil {
+		s.seen(ctx)
+	}
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+type panicking struct{}
+
+func (panicking) Name() string { return "Panicking" }
+
+func (panicking) HandleTx(context.Context, pgx.Tx, []byte) error { panic("nil map write") }
+
+// recording is a middleware's handler that notes its name when it runs.
+type recording struct {
+	handler.Handler
+	name  string
+	order *[]string
+}
+
+func (r recording) HandleTx(ctx context.Context, tx pgx.Tx, payload []byte) error {
+	*r.order = append(*r.order, r.name)
+	return r.Handler.HandleTx(ctx, tx, payload)
+}
+
+func TestChain_KeepsTheNameAndRunsOutermostFirst(t *testing.T) {
+	var order []string
+	record := func(name string) handler.Middleware {
+		return func(next handler.Handler) handler.Handler {
+			return recording{Handler: next, name: name, order: &order}
+		}
+	}
+
+	h := handler.Chain(&scripted{}, record("outer"), handler.Timeout(time.Minute), record("inner"))
+
+	require.Equal(t, "Scripted", h.Name(), "the registry routes on the wrapped handler's name")
+	require.NoError(t, h.HandleTx(context.Background(), nil, nil))
+	require.Equal(t, []string{"outer", "inner"}, order)
+}
+
+func TestTimeout_SetsADeadline(t *testing.T) {
+	var deadline time.Time
+	inner := &scripted{seen: func(ctx context.Context) { deadline, _ = ctx.Deadline() }}
+
+	require.NoError(t, handler.Timeout(time.Minute)(inner).HandleTx(context.Background(), nil, nil))
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+// SUBSCRIBER_HANDLER_TIMEOUT=0 means no bound, not an already-expired one.
+func TestTimeout_ZeroDisablesIt(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		var hasDeadline bool
+		inner := &scripted{seen: func(ctx context.Context) { _, hasDeadline = ctx.Deadline() }}
+
+		require.NoError(t, handler.Timeout(d)(inner).HandleTx(context.Background(), nil, nil))
+		require.False(t, hasDeadline, "timeout %s", d)
+	}
+}
+
+// A panic must become an error the consumer can retry and eventually park, not
+// a crash that takes every in-flight message with it.
+func TestRecover_TurnsAPanicIntoAnError(t *testing.T) {
+	h := handler.Recover(logger.New(false))(panicking{})
+
+	err := h.HandleTx(context.Background(), nil, nil)
+	require.ErrorIs(t, err, handler.ErrPanic)
+	require.Contains(t, err.Error(), "nil map write")
+}
+
+func TestIntegrationRetry_RetriesATransientPostgresError(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &scripted{errs: []error{&pgconn.PgError{Code: "40P01"}}}
+	h := handler.Chain(inner, handler.Retry(3, time.Millisecond))
+
+	require.NoError(t, handle(t, pool, h, payloadFor(t, sampleEvent(uuid.New()))))
+	require.Equal(t, 2, inner.calls)
+}
+
+// Anything else is the message's problem, or the dependency's for longer than
+// a moment. It goes back to the consumer's retry policy at once.
+func TestIntegrationRetry_ReturnsAnyOtherErrorAtOnce(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &scripted{errs: []error{errors.New("bad payload")}}
+	h := handler.Chain(inner, handler.Retry(3, time.Millisecond))
+
+	require.Error(t, handle(t, pool, h, payloadFor(t, sampleEvent(uuid.New()))))
+	require.Equal(t, 1, inner.calls)
+}
+
+// A failed attempt rolls back to its savepoint. Idempotent's inbox row shows
+// it: were the first attempt's row kept, the second would skip the handler as
+// a duplicate, and the registry's transaction must still commit the second.
+func TestIntegrationRetry_RollsBackAFailedAttempt(t *testing.T) {
+	testsupport.SkipUnlessDocker(t)
+	pool := testsupport.Pool(t)
+
+	inner := &scripted{errs: []error{&pgconn.PgError{Code: "40P01"}}}
+	h := handler.Chain(handler.NewIdempotent("eventify.test", inner, logger.New(false)), handler.Retry(3, time.Millisecond))
+	messageID := uuid.New()
+
+	require.NoError(t, handle(t, pool, h, payloadFor(t, sampleEvent(messageID))))
+	require.Equal(t, 2, inner.calls, "the retry must not be skipped as a duplicate of the failed attempt")
+	require.Equal(t, 1, processedCount(t, pool, "eventify.test", messageID))
+}
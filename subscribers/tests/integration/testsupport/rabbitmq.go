@@ -0,0 +1,124 @@
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	platformamqp "eventify/platform/amqp"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Broker starts the RabbitMQ image docker-compose runs and returns its AMQP
+// URI.
+//
+// The retry topology leans on the broker for everything that matters — TTLs,
+// dead-lettering, the x-death header, requeueing on a closed channel — so a
+// consumer test against anything less tests nothing.
+func Broker(t *testing.T) string {
+	t.Helper()
+
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "rabbitmq:3-management",
+			ExposedPorts: []string{"5672/tcp"},
+			WaitingFor: wait.ForLog("Server startup complete").
+				WithStartupTimeout(90 * time.Second),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("start rabbitmq container: %v", err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(context.Background()) })
+
+	endpoint, err := container.PortEndpoint(ctx, "5672/tcp", "")
+	if err != nil {
+		t.Fatalf("rabbitmq endpoint: %v", err)
+	}
+	return fmt.Sprintf("amqp://guest:guest@%s/", endpoint)
+}
+
+// Group names a consumer group of the test's own, so no two tests share a
+// queue.
+func Group() string { return "eventify.test." + uuid.NewString()[:8] }
+
+// RunConsumer starts c with handle and waits until it is consuming. The
+// returned stop cancels it and reports what Run returned.
+func RunConsumer(t *testing.T, c *platformamqp.Consumer, handle platformamqp.HandlerFunc) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx, handle) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(30 * time.Second)
+	for !c.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the consumer never connected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			done <- err
+			return err
+		case <-time.After(time.Minute):
+			t.Fatalf("Run did not return after its context was cancelled")
+			return nil
+		}
+	}
+}
+
+// Publish sends body under routingKey through a Publisher of its own, and
+// returns the message ID it was sent with.
+func Publish(t *testing.T, uri, routingKey string, body []byte) string {
+	t.Helper()
+	pub, err := platformamqp.NewPublisher(uri)
+	if err != nil {
+		t.Fatalf("dial publisher: %v", err)
+	}
+	defer func() { _ = pub.Close() }()
+
+	id := uuid.NewString()
+	if err := pub.Publish(context.Background(), routingKey, id, body); err != nil {
+		t.Fatalf("publish %s: %v", routingKey, err)
+	}
+	return id
+}
+
+// Channel opens a channel of the test's own.
+func Channel(t *testing.T, uri string) *amqp.Channel {
+	t.Helper()
+	conn, err := amqp.Dial(uri)
+	if err != nil {
+		t.Fatalf("dial amqp: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("open amqp channel: %v", err)
+	}
+	return ch
+}
+
+// Depth is how many messages wait in queue.
+func Depth(t *testing.T, ch *amqp.Channel, queue string) int {
+	t.Helper()
+	q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", queue, err)
+	}
+	return q.Messages
+}